@@ -0,0 +1,248 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/BurntSushi/xgbutil"
+
+	"github.com/seyys/sticky-display/common"
+	"github.com/seyys/sticky-display/ipc"
+	"github.com/seyys/sticky-display/store"
+)
+
+const (
+	ExitSuccess    = 0 // Command succeeded
+	ExitFailed     = 1 // Daemon replied with an error
+	ExitUsage      = 2 // Invalid command line usage
+	ExitConnection = 3 // Daemon is not reachable
+)
+
+type Options struct {
+	Json bool // Print raw json output
+}
+
+func Run(args []string) int {
+	opts, args := parseOptions(args)
+	if len(args) == 0 {
+		return usage()
+	}
+
+	// Choose command
+	switch args[0] {
+	case "msg":
+		if len(args) < 3 || args[1] != "action" {
+			return usage()
+		}
+		return request(ipc.Request{Action: strings.Join(args[2:], " ")}, opts)
+	case "query":
+		if len(args) < 2 {
+			return usage()
+		}
+		req := ipc.Request{State: args[1]}
+		if len(args) > 2 {
+			req.Window = args[2]
+		}
+		return request(req, opts)
+	case "explain":
+		req := ipc.Request{State: "explain", Window: "active"}
+		if len(args) > 1 {
+			req.Window = args[1]
+		}
+		return request(req, opts)
+	case "subscribe":
+		return subscribe(args[1:], opts)
+	case "pick":
+		return pick(args[1:], opts)
+	}
+
+	return usage()
+}
+
+func Usage() string {
+	return strings.Join([]string{
+		"  msg action <action>    execute an action (e.g. enable)",
+		"  query <state> [window] query a state (e.g. clients, displays, configs)",
+		"  explain [window]       explain the sticky decision of a window (default: active)",
+		"  pick [action]          pick a window with the pointer (info, pin, unpin, ignore)",
+		"  subscribe [events...]  stream events (e.g. pin unpin screen config action mode)",
+	}, "\n")
+}
+
+func usage() int {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] <command>\n\nCommands:\n%s\n", common.Build.Name, Usage())
+	return ExitUsage
+}
+
+func parseOptions(args []string) (Options, []string) {
+	opts := Options{Json: common.Args.Json}
+	rest := []string{}
+
+	// Extract options given after the command
+	for _, arg := range args {
+		switch arg {
+		case "-json", "--json":
+			opts.Json = true
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	return opts, rest
+}
+
+func request(req ipc.Request, opts Options) int {
+	conn, err := dial()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitConnection
+	}
+	defer conn.Close()
+
+	// Send request and wait for the reply
+	reply, err := conn.Send(req)
+	if reply == nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitConnection
+	}
+
+	// Print reply
+	if opts.Json {
+		data, _ := json.Marshal(reply)
+		fmt.Println(string(data))
+	} else {
+		printReply(reply)
+	}
+	if err != nil {
+		return ExitFailed
+	}
+
+	return ExitSuccess
+}
+
+func subscribe(events []string, opts Options) int {
+	conn, err := dial()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitConnection
+	}
+	defer conn.Close()
+
+	// Send subscription
+	ch, err := conn.Subscribe(events...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailed
+	}
+
+	// Print streamed events
+	for msg := range ch {
+		if opts.Json {
+			data, _ := json.Marshal(msg)
+			fmt.Println(string(data))
+			continue
+		}
+		fmt.Printf("%s %s %s\n", strings.ToLower(msg.Type), msg.Name, string(msg.Data))
+	}
+
+	return ExitSuccess
+}
+
+func pick(args []string, opts Options) int {
+	action := "info"
+	if len(args) > 0 {
+		action = args[0]
+	}
+	if len(args) > 1 || !common.IsInList(action, []string{"info", "pin", "unpin", "ignore"}) {
+		return usage()
+	}
+
+	// Pick window with the pointer
+	X, err := xgbutil.NewConn()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitConnection
+	}
+	w, err := store.PickWindow(X)
+	X.Conn().Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitFailed
+	}
+	window := fmt.Sprintf("%#x", w)
+
+	// Apply action to picked window
+	if action != "info" {
+		return request(ipc.Request{Action: action, Window: window}, opts)
+	}
+
+	// Print window information and decision
+	if code := request(ipc.Request{State: "info", Window: window}, opts); code != ExitSuccess {
+		return code
+	}
+	return request(ipc.Request{State: "explain", Window: window}, opts)
+}
+
+func dial() (*ipc.Conn, error) {
+	conn, err := ipc.Dial(common.Args.Sock + ".in")
+	if err != nil {
+		return nil, fmt.Errorf("%s is not running (%s)", common.Build.Name, err)
+	}
+	return conn, nil
+}
+
+func printReply(reply *ipc.Reply[json.RawMessage]) {
+	if reply.Code != ipc.CodeSuccess {
+		fmt.Fprintf(os.Stderr, "error: %s\n", reply.Error)
+		return
+	}
+
+	// Print decision trace line by line
+	if reply.Name == "explain" {
+		var d ipc.Decision
+		if err := json.Unmarshal(reply.Data, &d); err == nil {
+			for _, line := range d.Trace {
+				fmt.Println(line)
+			}
+			return
+		}
+	}
+
+	// Print clients and displays as table
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	switch reply.Name {
+	case "clients":
+		var clients []ipc.Client
+		if err := json.Unmarshal(reply.Data, &clients); err == nil {
+			fmt.Fprintln(w, "ID\tCLASS\tDESK\tSCREEN\tPINNED\tSTICKY\tOVERRIDE\tNAME")
+			for _, c := range clients {
+				fmt.Fprintf(w, "%#x\t%s\t%d\t%d\t%t\t%t\t%s\t%s\n", c.Id, c.Class, c.Desk, c.Screen, c.Pinned, c.Sticky, c.Override, c.Name)
+			}
+			return
+		}
+	case "displays":
+		var displays []ipc.Display
+		if err := json.Unmarshal(reply.Data, &displays); err == nil {
+			fmt.Fprintln(w, "SCREEN\tOUTPUT\tMONITOR\tGEOMETRY\tWORKAREA\tSTICKY\tACTIVE")
+			for _, d := range displays {
+				workarea := fmt.Sprintf("%dx%d%+d%+d", d.Workarea.Width, d.Workarea.Height, d.Workarea.X, d.Workarea.Y)
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%t\t%t\n", d.Screen, d.Output.Name, d.Output.Monitor, d.Output.Geometry, workarea, d.Sticky, d.Active)
+			}
+			return
+		}
+	}
+
+	// Print other data indented
+	if len(reply.Data) == 0 || string(reply.Data) == "null" {
+		fmt.Println("ok")
+		return
+	}
+	var data bytes.Buffer
+	json.Indent(&data, reply.Data, "", "  ")
+	fmt.Println(data.String())
+}
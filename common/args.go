@@ -6,8 +6,9 @@ import (
 )
 
 var (
-	Build BuildInfo // Build information
-	Args  Arguments // Parsed arguments
+	Build        BuildInfo // Build information
+	Args         Arguments // Parsed arguments
+	CommandUsage string    // Client commands usage text
 )
 
 type BuildInfo struct {
@@ -19,14 +20,20 @@ type BuildInfo struct {
 }
 
 type Arguments struct {
-	Config       string // Argument for config file path
-	PrintDisplay bool   // Print the number of the current display
-	Lock         string // Argument for lock file path
-	Sock         string // Argument for sock file path
-	Log          string // Argument for log file path
-	VVV          bool   // Argument for very very verbose mode
-	VV           bool   // Argument for very verbose mode
-	V            bool   // Argument for verbose mode
+	Config       string   // Argument for config file path
+	PrintDisplay bool     // Print the number of the current display
+	CheckConfig  bool     // Validate the config file and exit
+	PrintConfig  bool     // Print the config merged with the defaults
+	KeepState    bool     // Keep window states on exit
+	Explain      string   // Explain the sticky decision of a window
+	Lock         string   // Argument for lock file path
+	Sock         string   // Argument for sock file path
+	Log          string   // Argument for log file path
+	Json         bool     // Print raw json replies of client commands
+	VVV          bool     // Argument for very very verbose mode
+	VV           bool     // Argument for very verbose mode
+	V            bool     // Argument for verbose mode
+	Command      []string // Client command for a running daemon
 }
 
 func InitArgs(name, version, commit, date string) {
@@ -43,9 +50,14 @@ func InitArgs(name, version, commit, date string) {
 	// Command line arguments
 	flag.StringVar(&Args.Config, "config", ConfigFilePath(Build.Name), "config file path")
 	flag.BoolVar(&Args.PrintDisplay, "print-display", false, "number of current display")
+	flag.BoolVar(&Args.CheckConfig, "check-config", false, "validate config file and exit")
+	flag.BoolVar(&Args.PrintConfig, "print-config", false, "print config merged with defaults")
+	flag.StringVar(&Args.Explain, "explain", "", "explain sticky decision of window id (or \"active\")")
+	flag.BoolVar(&Args.KeepState, "keep-state", false, "keep sticky windows sticky on exit")
 	flag.StringVar(&Args.Lock, "lock", fmt.Sprintf("/tmp/%s.lock", Build.Name), "lock file path")
 	flag.StringVar(&Args.Sock, "sock", fmt.Sprintf("/tmp/%s.sock", Build.Name), "sock file path")
 	flag.StringVar(&Args.Log, "log", fmt.Sprintf("/tmp/%s.log", Build.Name), "log file path")
+	flag.BoolVar(&Args.Json, "json", false, "print raw json replies of commands")
 	flag.BoolVar(&Args.VVV, "vvv", false, "very very verbose mode")
 	flag.BoolVar(&Args.VV, "vv", false, "very verbose mode")
 	flag.BoolVar(&Args.V, "v", false, "verbose mode")
@@ -54,8 +66,10 @@ func InitArgs(name, version, commit, date string) {
 	flag.CommandLine.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "%s\n\nUsage:\n", Build.Summary)
 		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "\nCommands:\n%s\n", CommandUsage)
 	}
 
 	// Parse arguments
 	flag.Parse()
+	Args.Command = flag.Args()
 }
@@ -1,7 +1,13 @@
 package common
 
 import (
+	"bytes"
 	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"io/ioutil"
 	"os"
@@ -17,10 +23,74 @@ var (
 	Config Configuration // Decoded config values
 )
 
+var (
+	configCallbacksFun []func(string) // Config events callback functions
+	configChanges      []string       // Config sections changed by the last reload
+)
+
 type Configuration struct {
-	StickyDisplays []int             `toml:"sticky_displays"` // Display numbers to sticky windows on
-	WindowIgnore   [][]string        `toml:"window_ignore"`   // Regex to ignore windows
-	Keys           map[string]string `toml:"keys"`            // Event bindings for keyboard shortcuts
+	Include         []string                 `toml:"include"`          // Additional config files (globs, {hostname})
+	StickyDisplays  []Display                `toml:"sticky_displays"`  // Displays to sticky windows on
+	StickyPolicy    string                   `toml:"sticky_policy"`    // Policy on manual sticky changes (enforce, respect)
+	PersistDisplays bool                     `toml:"persist_displays"` // Write runtime display changes to config file
+	WindowIgnore    [][]string               `toml:"window_ignore"`    // Regex to ignore windows
+	Rules           []Rule                   `toml:"rules"`            // Ordered rules for sticky decisions
+	Displays        map[string]DisplayConfig `toml:"display"`          // Per display settings by display identifier
+	Keys            map[string]string        `toml:"keys"`             // Event bindings for keyboard shortcuts
+	Modes           map[string]Mode          `toml:"modes"`            // Binding modes entered with a leader key
+	Mouse           map[string]string        `toml:"mouse"`            // Event bindings for mouse buttons
+}
+
+type Rule struct {
+	Class     string  `toml:"class,omitempty"`     // Regex on window class name
+	Instance  string  `toml:"instance,omitempty"`  // Regex on window instance name
+	Title     string  `toml:"title,omitempty"`     // Regex on window title
+	Role      string  `toml:"role,omitempty"`      // Regex on window role
+	Type      string  `toml:"type,omitempty"`      // Window type (e.g. dialog)
+	Transient *bool   `toml:"transient,omitempty"` // Window is transient for another window
+	Display   Display `toml:"display,omitempty"`   // Display the window is on
+	Outcome   string  `toml:"outcome"`             // Rule outcome (sticky, never, ignore)
+}
+
+type DisplayConfig struct {
+	Policy       string     `toml:"policy"`        // Sticky policy of the display (always, never, rules)
+	States       []string   `toml:"states"`        // Extra window states to apply (e.g. above)
+	WindowIgnore [][]string `toml:"window_ignore"` // Regex to ignore windows on the display
+	SettleDelay  int        `toml:"settle_delay"`  // Milliseconds to wait before pinning moved windows
+}
+
+type Mode struct {
+	Leader     string            `toml:"leader"`     // Key combination that enters the mode
+	Timeout    int               `toml:"timeout"`    // Milliseconds until the mode is left (0 to disable)
+	Persistent bool              `toml:"persistent"` // Stay in the mode after an action
+	Keys       map[string]string `toml:"keys"`       // Event bindings for single keys inside the mode
+}
+
+type Display string // Display identifier (index, output name, edid or geometry)
+
+func (d *Display) UnmarshalTOML(value interface{}) error {
+
+	// Accept display indices and identifier strings
+	switch v := value.(type) {
+	case int64:
+		*d = Display(strconv.FormatInt(v, 10))
+	case string:
+		*d = Display(strings.TrimSpace(v))
+	default:
+		return fmt.Errorf("invalid display identifier %v", value)
+	}
+
+	return nil
+}
+
+func (d Display) MarshalTOML() ([]byte, error) {
+
+	// Write display indices as numbers
+	if _, err := strconv.Atoi(string(d)); err == nil {
+		return []byte(d), nil
+	}
+
+	return []byte(strconv.Quote(string(d))), nil
 }
 
 func InitConfig() {
@@ -37,12 +107,64 @@ func InitConfig() {
 	}
 
 	// Read config file into memory
-	readConfig(Args.Config)
+	if !readConfig(Args.Config) {
+		log.Error("Invalid config, use default config [", Args.Config, "]")
+		Config = DefaultConfig()
+	}
 
 	// Config file watcher
 	watchConfig(Args.Config)
 }
 
+func DefaultConfig() Configuration {
+	config := Configuration{}
+
+	// Decode embedded default config
+	if _, err := toml.Decode(string(File.Toml), &config); err != nil {
+		log.Error("Error decoding default config ", err)
+	}
+
+	return config
+}
+
+func AnnotatedConfig(configFilePath string) (string, error) {
+	config, defined, errs := decodeConfigFiles(configFilePath)
+	if HasConfigErrors(errs) {
+		return "", errs[0]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Config merged with the defaults from:\n")
+	for _, file := range ConfigFiles(configFilePath) {
+		fmt.Fprintf(&b, "#   %s\n", file)
+	}
+	fmt.Fprintf(&b, "# Options marked with '# default' are not set in any file\n")
+
+	// Encode each section (keys are ordered before tables)
+	v := reflect.ValueOf(config)
+	for i := 0; i < v.NumField(); i++ {
+		key := v.Type().Field(i).Tag.Get("toml")
+
+		var section bytes.Buffer
+		enc := toml.NewEncoder(&section)
+		enc.Indent = ""
+		if err := enc.Encode(map[string]interface{}{key: v.Field(i).Interface()}); err != nil {
+			return "", err
+		}
+
+		b.WriteString("\n")
+		if !IsInList(key, defined) {
+			b.WriteString("# default\n")
+		}
+		if section.Len() == 0 {
+			fmt.Fprintf(&b, "# %s is empty\n", key)
+		}
+		b.Write(section.Bytes())
+	}
+
+	return b.String(), nil
+}
+
 func ConfigFilePath(name string) string {
 
 	// Obtain user home directory
@@ -61,23 +183,139 @@ func ConfigFilePath(name string) string {
 	return filepath.Join(configFolderPath, "config.toml")
 }
 
-func readConfig(configFilePath string) {
+func ConfigChanged(sections ...string) bool {
+	for _, section := range sections {
+		if IsInList(section, configChanges) {
+			return true
+		}
+	}
+	return false
+}
+
+func readConfig(configFilePath string) bool {
 	fmt.Println(fmt.Errorf("LOAD %s [%s]", configFilePath, Build.Summary))
 	log.Info("Starting [", Build.Summary, "]")
 
-	// Decode contents into struct
-	toml.DecodeFile(configFilePath, &Config)
+	// Decode and validate contents
+	config, errs := DecodeConfig(configFilePath)
+	ConfigErrors = errs
+	for _, err := range errs {
+		log.Warn("Config ", configFilePath, ": ", err)
+	}
+	if HasConfigErrors(errs) {
+		return false
+	}
+
+	// Compare with previous config
+	configChanges = configDiff(Config, config)
+	Config = config
+
+	return true
+}
+
+func reloadConfig(configFilePath string) {
+
+	// Keep last valid config
+	if !readConfig(configFilePath) {
+		log.Error("Invalid config, keep previous config [", configFilePath, "]")
+		configCallbacks("config-error")
+		return
+	}
+	if len(configChanges) == 0 {
+		log.Debug("Config unchanged [", configFilePath, "]")
+		return
+	}
+
+	log.Info("Config changed ", configChanges)
+
+	// Execute callbacks
+	configCallbacks("config-reloaded")
+}
+
+func configDiff(a Configuration, b Configuration) []string {
+	changes := []string{}
+
+	// Compare config sections by toml name
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	for i := 0; i < va.NumField(); i++ {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			changes = append(changes, va.Type().Field(i).Tag.Get("toml"))
+		}
+	}
+
+	return changes
+}
+
+func WriteStickyDisplays(configFilePath string, displays []Display) error {
+
+	// Write to the file that defines the merged value
+	configFilePath = ConfigFileOf(configFilePath, "sticky_displays")
+	content, err := ioutil.ReadFile(configFilePath)
+	if err != nil {
+		return err
+	}
+
+	// Format display list
+	values := make([]string, len(displays))
+	for i, d := range displays {
+		value, _ := d.MarshalTOML()
+		values[i] = string(value)
+	}
+	line := fmt.Sprintf("sticky_displays = [%s]", strings.Join(values, ", "))
+
+	// Replace existing entry or prepend a new one
+	pattern := regexp.MustCompile(`(?ms)^sticky_displays\s*=\s*\[.*?\]`)
+	if pattern.Match(content) {
+		content = pattern.ReplaceAllLiteral(content, []byte(line))
+	} else {
+		content = append([]byte(line+"\n\n"), content...)
+	}
+
+	return ioutil.WriteFile(configFilePath, content, 0644)
+}
+
+func WriteRule(configFilePath string, rule Rule) error {
+
+	// Write to the file whose rules match first
+	configFilePath = ConfigFileOf(configFilePath, "rules")
+	content, err := ioutil.ReadFile(configFilePath)
+	if err != nil {
+		return err
+	}
+
+	// Format rule fields
+	fields := []string{}
+	if len(rule.Class) > 0 {
+		fields = append(fields, "class = "+strconv.Quote(rule.Class))
+	}
+	fields = append(fields, "outcome = "+strconv.Quote(rule.Outcome))
+
+	// Insert rule before existing rules, the first matching rule wins
+	inline := regexp.MustCompile(`(?m)^[ \t]*rules[ \t]*=[ \t]*\[`)
+	table := regexp.MustCompile(`(?m)^[ \t]*\[\[[ \t]*rules[ \t]*\]\]`)
+	if loc := inline.FindIndex(content); loc != nil {
+		entry := "\n  { " + strings.Join(fields, ", ") + " },"
+		content = append(content[:loc[1]:loc[1]], append([]byte(entry), content[loc[1]:]...)...)
+	} else if loc := table.FindIndex(content); loc != nil {
+		block := "[[rules]]\n" + strings.Join(fields, "\n") + "\n\n"
+		content = append(content[:loc[0]:loc[0]], append([]byte(block), content[loc[0]:]...)...)
+	} else {
+		content = append(content, []byte("\n[[rules]]\n"+strings.Join(fields, "\n")+"\n")...)
+	}
+
+	return ioutil.WriteFile(configFilePath, content, 0644)
 }
 
 func watchConfig(configFilePath string) {
+	var timer *time.Timer
 
-	// Init file watcher
+	// Init directory watcher (editors may save via rename)
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		log.Error(err)
-	} else {
-		watcher.Add(configFilePath)
+		return
 	}
+	watchConfigDirs(watcher, configFilePath)
 
 	// Listen for events
 	go func() {
@@ -87,9 +325,22 @@ func watchConfig(configFilePath string) {
 				if !ok {
 					return
 				}
-				if event.Has(fsnotify.Write) {
-					readConfig(configFilePath)
+				if !isConfigFile(configFilePath, event.Name) {
+					continue
+				}
+
+				// Wait for all events of a save
+				if timer != nil {
+					timer.Stop()
 				}
+				timer = time.AfterFunc(100*time.Millisecond, func() {
+					Dispatch(func() {
+						reloadConfig(configFilePath)
+					})
+
+					// Follow changed includes
+					watchConfigDirs(watcher, configFilePath)
+				})
 			case err, ok := <-watcher.Errors:
 				if !ok {
 					return
@@ -99,3 +350,42 @@ func watchConfig(configFilePath string) {
 		}
 	}()
 }
+
+func watchConfigDirs(watcher *fsnotify.Watcher, configFilePath string) {
+	dirs := ConfigDirs(configFilePath)
+	for _, file := range ConfigFiles(configFilePath) {
+		dirs = append(dirs, filepath.Dir(file))
+	}
+
+	// Watch directories of all config files
+	for _, dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			log.Trace("Skip config directory watch ", dir, ": ", err)
+		}
+	}
+}
+
+func isConfigFile(configFilePath string, name string) bool {
+	name = filepath.Clean(name)
+
+	// Check new or removed fragments and fragment directories
+	dirs := ConfigDirs(configFilePath)
+	if IsInList(name, dirs) || (filepath.Ext(name) == ".toml" && IsInList(filepath.Dir(name), dirs)) {
+		return true
+	}
+
+	// Check loaded config files
+	return IsInList(name, ConfigFiles(configFilePath))
+}
+
+func OnConfigUpdate(fun func(string)) {
+	configCallbacksFun = append(configCallbacksFun, fun)
+}
+
+func configCallbacks(arg string) {
+	log.Info("Config event ", arg)
+
+	for _, fun := range configCallbacksFun {
+		fun(arg)
+	}
+}
@@ -0,0 +1,128 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+func ConfigFiles(configFilePath string) []string {
+	files := []string{}
+	visited := make(map[string]bool)
+
+	// Main config file and its includes
+	addConfigFile(configFilePath, &files, visited)
+
+	// Drop-in fragments in lexical order, host specific fragments last
+	for _, dir := range ConfigDirs(configFilePath) {
+		fragments, _ := filepath.Glob(filepath.Join(dir, "*.toml"))
+		sort.Strings(fragments)
+		for _, file := range fragments {
+			addConfigFile(file, &files, visited)
+		}
+	}
+
+	return files
+}
+
+func ConfigDirs(configFilePath string) []string {
+	dir := filepath.Join(filepath.Dir(configFilePath), "config.d")
+	return []string{dir, filepath.Join(dir, hostname())}
+}
+
+func ConfigFileOf(configFilePath string, key string) string {
+	file := configFilePath
+
+	// Last file defining the key wins the merge
+	for _, f := range ConfigFiles(configFilePath) {
+		values := map[string]interface{}{}
+		md, err := toml.DecodeFile(f, &values)
+		if err == nil && md.IsDefined(key) {
+			file = f
+		}
+	}
+
+	return file
+}
+
+func addConfigFile(file string, files *[]string, visited map[string]bool) {
+	file = filepath.Clean(file)
+	if visited[file] {
+		return
+	}
+	visited[file] = true
+	*files = append(*files, file)
+
+	// Read include directive
+	include := struct {
+		Include []string `toml:"include"`
+	}{}
+	toml.DecodeFile(file, &include)
+
+	// Add included files after the including file
+	for _, pattern := range include.Include {
+		pattern = strings.ReplaceAll(pattern, "{hostname}", hostname())
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(file), pattern)
+		}
+
+		// Keep missing literal paths to report them
+		matches, _ := filepath.Glob(pattern)
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			matches = []string{pattern}
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			addConfigFile(match, files, visited)
+		}
+	}
+}
+
+func mergeConfig(dst *Configuration, src Configuration, md *toml.MetaData) {
+	d, s := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src)
+
+	// Overlay sections defined in the source file
+	for i := 0; i < d.NumField(); i++ {
+		if !md.IsDefined(d.Type().Field(i).Tag.Get("toml")) {
+			continue
+		}
+		df, sf := d.Field(i), s.Field(i)
+		switch {
+
+		// Merge tables by key, empty strings remove the key (e.g. to unbind a default key)
+		case df.Kind() == reflect.Map:
+			if df.IsNil() {
+				df.Set(reflect.MakeMap(df.Type()))
+			}
+			iter := sf.MapRange()
+			for iter.Next() {
+				value := iter.Value()
+				if value.Kind() == reflect.String && value.Len() == 0 {
+					value = reflect.Value{}
+				}
+				df.SetMapIndex(iter.Key(), value)
+			}
+
+		// Prepend arrays of tables, so rules of later files match first
+		case df.Kind() == reflect.Slice && df.Type().Elem().Kind() == reflect.Struct:
+			merged := reflect.MakeSlice(df.Type(), 0, sf.Len()+df.Len())
+			df.Set(reflect.AppendSlice(reflect.AppendSlice(merged, sf), df))
+
+		// Replace values
+		default:
+			df.Set(sf)
+		}
+	}
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "localhost"
+	}
+	return name
+}
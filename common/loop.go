@@ -0,0 +1,26 @@
+package common
+
+var (
+	tasks = make(chan func(), 256) // Functions to run on the main event loop
+)
+
+func Dispatch(fun func()) {
+
+	// Queue function for the main event loop
+	tasks <- fun
+}
+
+func DispatchWait(fun func()) {
+	done := make(chan struct{})
+
+	// Queue function and wait until it was executed
+	tasks <- func() {
+		defer close(done)
+		fun()
+	}
+	<-done
+}
+
+func Tasks() <-chan func() {
+	return tasks
+}
@@ -0,0 +1,292 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/dlclark/regexp2"
+)
+
+var (
+	ConfigErrors []ConfigError // Errors of the last config validation
+
+	decodeErrorPattern = regexp.MustCompile(`^toml: line (\d+)(?: \(last key [^)]*\))?: (.*)$`) // Decode error message pattern
+
+	validateCallbacksFun []func(Configuration) []ConfigError // Config validation callback functions
+)
+
+type ConfigError struct {
+	File    string // Config file of the error
+	Line    int    // Line number in the config file (0 if unknown)
+	Message string // Error description
+	Warning bool   // Reported without rejecting the config
+}
+
+func (e ConfigError) Error() string {
+	prefix := "error"
+	if e.Warning {
+		prefix = "warning"
+	}
+	if len(e.File) > 0 {
+		prefix = e.File + ": " + prefix
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("%s: line %d: %s", prefix, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", prefix, e.Message)
+}
+
+func CheckConfig(configFilePath string) []ConfigError {
+	_, errs := DecodeConfig(configFilePath)
+	return errs
+}
+
+func DecodeConfig(configFilePath string) (Configuration, []ConfigError) {
+	config, _, errs := decodeConfigFiles(configFilePath)
+	return config, errs
+}
+
+func decodeConfigFiles(configFilePath string) (Configuration, []string, []ConfigError) {
+	config := DefaultConfig()
+	defined := []string{}
+	errs := []ConfigError{}
+
+	// Merge included files and fragments on top of the defaults
+	for i, file := range ConfigFiles(configFilePath) {
+
+		// Skip missing includes (e.g. host specific files)
+		if _, err := os.Stat(file); i > 0 && os.IsNotExist(err) {
+			errs = append(errs, ConfigError{File: file, Message: "included file does not exist", Warning: true})
+			continue
+		}
+
+		fileConfig, md, fileErrs := decodeConfigFile(file)
+		errs = append(errs, fileErrs...)
+		if md == nil {
+			continue
+		}
+		mergeConfig(&config, fileConfig, md)
+		for _, key := range md.Keys() {
+			if !IsInList(key[0], defined) {
+				defined = append(defined, key[0])
+			}
+		}
+	}
+
+	// Check merged config values
+	for _, fun := range validateCallbacksFun {
+		errs = append(errs, fun(config)...)
+	}
+
+	return config, defined, errs
+}
+
+func decodeConfigFile(file string) (Configuration, *toml.MetaData, []ConfigError) {
+	config := Configuration{}
+
+	// Read raw contents for line lookups
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return config, nil, []ConfigError{{File: file, Message: err.Error()}}
+	}
+
+	// Decode contents into struct
+	md, err := toml.Decode(string(content), &config)
+	if err != nil {
+		e := decodeError(err)
+		e.File = file
+		return config, nil, []ConfigError{e}
+	}
+
+	// Check unknown keys
+	errs := []ConfigError{}
+	for _, key := range md.Undecoded() {
+		errs = append(errs, ConfigError{Line: lineOf(content, key[len(key)-1], 0), Message: fmt.Sprintf("unknown key %q", key.String())})
+	}
+
+	// Check config values
+	errs = append(errs, validateConfig(config, content)...)
+	for i := range errs {
+		errs[i].File = file
+	}
+
+	return config, &md, errs
+}
+
+func decodeError(err error) ConfigError {
+	var perr toml.ParseError
+	if errors.As(err, &perr) {
+		err = perr
+	}
+
+	// Split line number from message
+	match := decodeErrorPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return ConfigError{Message: err.Error()}
+	}
+	line, _ := strconv.Atoi(match[1])
+
+	return ConfigError{Line: line, Message: match[2]}
+}
+
+func HasConfigErrors(errs []ConfigError) bool {
+	for _, err := range errs {
+		if !err.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+func OnConfigValidate(fun func(Configuration) []ConfigError) {
+	validateCallbacksFun = append(validateCallbacksFun, fun)
+}
+
+func validateConfig(config Configuration, content []byte) []ConfigError {
+	errs := []ConfigError{}
+
+	// Validate sticky displays
+	line := lineOf(content, "sticky_displays", 0)
+	for _, d := range config.StickyDisplays {
+		if err := validateDisplay(d); err != nil {
+			errs = append(errs, ConfigError{Line: line, Message: err.Error()})
+		}
+	}
+
+	// Validate sticky policy
+	if !IsInList(config.StickyPolicy, []string{"", "enforce", "respect"}) {
+		errs = append(errs, ConfigError{Line: lineOf(content, "sticky_policy", 0), Message: fmt.Sprintf("invalid sticky_policy %q (enforce, respect)", config.StickyPolicy)})
+	}
+
+	// Validate window ignore rows
+	line = lineOf(content, "window_ignore", 0)
+	for i, row := range config.WindowIgnore {
+		if len(row) != 2 {
+			errs = append(errs, ConfigError{Line: line, Message: fmt.Sprintf("window_ignore row %d needs a class and a name expression, got %d values", i, len(row))})
+			continue
+		}
+		for _, expr := range row {
+			if err := validateRegex(expr); err != nil {
+				errs = append(errs, ConfigError{Line: line, Message: fmt.Sprintf("window_ignore row %d: %s", i, err)})
+			}
+		}
+	}
+
+	// Validate rules
+	for i, rule := range config.Rules {
+		line := lineOf(content, "[[rules]]", i)
+		for _, expr := range []string{rule.Class, rule.Instance, rule.Title, rule.Role} {
+			if err := validateRegex(expr); err != nil {
+				errs = append(errs, ConfigError{Line: line, Message: fmt.Sprintf("rule %d: %s", i, err)})
+			}
+		}
+		if !IsInList(rule.Outcome, []string{"sticky", "never", "ignore"}) {
+			errs = append(errs, ConfigError{Line: line, Message: fmt.Sprintf("rule %d: invalid outcome %q (sticky, never, ignore)", i, rule.Outcome)})
+		}
+		if len(rule.Display) > 0 {
+			if err := validateDisplay(rule.Display); err != nil {
+				errs = append(errs, ConfigError{Line: line, Message: fmt.Sprintf("rule %d: %s", i, err)})
+			}
+		}
+	}
+
+	// Validate display tables in a stable order
+	ids := []string{}
+	for id := range config.Displays {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		dc := config.Displays[id]
+		line := lineOf(content, "display."+id, 0)
+		if line == 0 {
+			line = lineOf(content, "display."+strconv.Quote(id), 0)
+		}
+		if err := validateDisplay(Display(id)); err != nil {
+			errs = append(errs, ConfigError{Line: line, Message: fmt.Sprintf("display %q: %s", id, err)})
+		}
+		if !IsInList(dc.Policy, []string{"", "always", "never", "rules"}) {
+			errs = append(errs, ConfigError{Line: line, Message: fmt.Sprintf("display %q: invalid policy %q (always, never, rules)", id, dc.Policy)})
+		}
+		for _, state := range dc.States {
+			if len(strings.TrimSpace(state)) == 0 {
+				errs = append(errs, ConfigError{Line: line, Message: fmt.Sprintf("display %q: empty window state", id)})
+			}
+		}
+		for i, row := range dc.WindowIgnore {
+			if len(row) != 2 {
+				errs = append(errs, ConfigError{Line: line, Message: fmt.Sprintf("display %q: window_ignore row %d needs a class and a name expression, got %d values", id, i, len(row))})
+				continue
+			}
+			for _, expr := range row {
+				if err := validateRegex(expr); err != nil {
+					errs = append(errs, ConfigError{Line: line, Message: fmt.Sprintf("display %q: window_ignore row %d: %s", id, i, err)})
+				}
+			}
+		}
+		if dc.SettleDelay < 0 {
+			errs = append(errs, ConfigError{Line: line, Message: fmt.Sprintf("display %q: negative settle_delay %d", id, dc.SettleDelay)})
+		}
+	}
+
+	// Validate binding modes
+	for name, mode := range config.Modes {
+		if len(strings.TrimSpace(mode.Leader)) == 0 {
+			errs = append(errs, ConfigError{Line: lineOf(content, "modes."+name, 0), Message: fmt.Sprintf("mode %q has no leader key", name)})
+		}
+	}
+
+	return errs
+}
+
+func validateDisplay(d Display) error {
+	id := strings.TrimSpace(string(d))
+	if len(id) == 0 {
+		return fmt.Errorf("empty display identifier")
+	}
+
+	// Check display index
+	if num, err := strconv.Atoi(id); err == nil && num < 0 {
+		return fmt.Errorf("negative display number %d", num)
+	}
+
+	// Check explicit identifier types
+	if kind, value, found := strings.Cut(id, ":"); found && IsInList(strings.ToLower(kind), []string{"output", "edid", "serial", "geometry"}) && len(value) == 0 {
+		return fmt.Errorf("empty %s identifier %q", kind, id)
+	}
+
+	return nil
+}
+
+func validateRegex(expr string) error {
+	if len(expr) == 0 {
+		return nil
+	}
+	if _, err := regexp2.Compile(strings.ToLower(expr), regexp2.None); err != nil {
+		return fmt.Errorf("invalid expression %q: %s", expr, err)
+	}
+	return nil
+}
+
+func lineOf(content []byte, key string, index int) int {
+
+	// Find the nth line that defines the key or table
+	pattern := regexp.MustCompile(`^\s*(\[+\s*)?["']?` + regexp.QuoteMeta(strings.Trim(key, "[]")) + `["']?\s*(\]+|=)`)
+	for i, line := range strings.Split(string(content), "\n") {
+		if !pattern.MatchString(line) {
+			continue
+		}
+		if index == 0 {
+			return i + 1
+		}
+		index--
+	}
+
+	return 0
+}
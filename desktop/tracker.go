@@ -5,6 +5,7 @@ import (
 
 	"github.com/BurntSushi/xgb/xproto"
 	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/ewmh"
 	"github.com/BurntSushi/xgbutil/xevent"
 	"github.com/BurntSushi/xgbutil/xprop"
 
@@ -28,6 +29,7 @@ type Location struct {
 type Handler struct {
 	Timer      *time.Timer    // Timer to handle delayed structure events
 	SwapScreen *HandlerClient // Stores client for screen swap
+	MoveScreen *HandlerClient // Stores client moved by an action
 }
 
 type HandlerClient struct {
@@ -43,12 +45,14 @@ func CreateTracker(ws map[Location]*Workspace) *Tracker {
 		Action:     make(chan string),
 		Handler: &Handler{
 			SwapScreen: &HandlerClient{},
+			MoveScreen: &HandlerClient{},
 		},
 	}
 
 	// Attach to root events
 	store.OnStateUpdate(tr.onStateUpdate)
 	store.OnPointerUpdate(tr.onPointerUpdate)
+	common.OnConfigUpdate(tr.onConfigUpdate)
 
 	// Update on startup
 	tr.Update()
@@ -92,6 +96,107 @@ func (tr *Tracker) Reset() {
 	tr.Workspaces = CreateWorkspaces()
 }
 
+func (tr *Tracker) Repin() {
+	log.Debug("Re-evaluate pinned clients [", len(tr.Clients), "]")
+
+	// Re-evaluate pin state of every client
+	for _, c := range tr.Clients {
+		tr.pinClient(c)
+	}
+}
+
+func (tr *Tracker) ActiveClient() *store.Client {
+	return tr.Clients[store.ActiveWindow]
+}
+
+func (tr *Tracker) ClientAt(p *common.Pointer) *store.Client {
+	if c, ok := tr.Clients[store.WindowAt(p)]; ok {
+		return c
+	}
+
+	return nil
+}
+
+func (tr *Tracker) ToggleSticky(c *store.Client) {
+	if !tr.isTracked(c.Win.Id) {
+		return
+	}
+
+	// Override display rule
+	c.ToggleOverride()
+}
+
+func (tr *Tracker) PinWindow(w xproto.Window, sticky bool) {
+	c, ok := tr.Clients[w]
+	if ok {
+		if sticky {
+			c.SetOverride("sticky")
+		} else {
+			c.SetOverride("unsticky")
+		}
+		return
+	}
+
+	// Change sticky state of untracked window
+	action := 0
+	if sticky {
+		action = 1
+	}
+	ewmh.WmStateReq(store.X, w, action, "_NET_WM_STATE_STICKY")
+}
+
+func (tr *Tracker) MoveClient(c *store.Client, screenNum uint) bool {
+	if !tr.isTracked(c.Win.Id) || !c.MoveToScreen(screenNum) {
+		return false
+	}
+
+	// Update workspace after structure events
+	tr.Handler.MoveScreen = &HandlerClient{Active: true, Source: c}
+	tr.onPointerUpdate(0)
+
+	return true
+}
+
+func (tr *Tracker) SendToSticky(c *store.Client) bool {
+	if !tr.isTracked(c.Win.Id) || store.IsStickyScreen(c.Latest.ScreenNum) {
+		return false
+	}
+
+	// Move to first sticky screen
+	for screenNum := uint(0); screenNum < store.ScreenCount; screenNum++ {
+		if !store.IsStickyScreen(screenNum) {
+			continue
+		}
+		previous := c.Latest
+		if !tr.MoveClient(c, screenNum) {
+			return false
+		}
+		c.Previous = previous
+		return true
+	}
+
+	return false
+}
+
+func (tr *Tracker) SendBack(c *store.Client) bool {
+	if !tr.isTracked(c.Win.Id) || c.Previous == nil {
+		return false
+	}
+
+	// Restore previous geometry
+	x, y, w, h := c.Previous.Dimensions.Geometry.Pieces()
+	c.MoveResizeKeepState(x, y, w, h)
+	c.Previous = nil
+
+	log.Info("Send window back to screen ", c.Latest.ScreenNum, " [", c.Latest.Class, "]")
+
+	// Update workspace after structure events
+	tr.Handler.MoveScreen = &HandlerClient{Active: true, Source: c}
+	tr.onPointerUpdate(0)
+
+	return true
+}
+
 func (tr *Tracker) ActiveWorkspace() *Workspace {
 	location := Location{ScreenNum: store.CurrentScreen}
 
@@ -116,6 +221,10 @@ func (tr *Tracker) ClientWorkspace(c *store.Client) *Workspace {
 	return ws
 }
 
+func (tr *Tracker) Explain(w xproto.Window) *store.Decision {
+	return store.Explain(w, tr.Clients[w])
+}
+
 func (tr *Tracker) trackWindow(w xproto.Window) bool {
 	if tr.isTracked(w) {
 		return false
@@ -124,8 +233,9 @@ func (tr *Tracker) trackWindow(w xproto.Window) bool {
 	// Add new client
 	c := store.CreateClient(w)
 	tr.Clients[c.Win.Id] = c
-	ws := tr.ClientWorkspace(c)
-	ws.AddClient(c)
+	if ws := tr.ClientWorkspace(c); ws != nil {
+		ws.AddClient(c)
+	}
 	c.Pin()
 
 	// Attach handlers
@@ -150,9 +260,11 @@ func (tr *Tracker) untrackWindow(w xproto.Window) bool {
 	c.Restore(false)
 
 	// Remove client
-	ws.RemoveClient(c)
+	if ws != nil {
+		ws.RemoveClient(c)
+	}
 	delete(tr.Clients, w)
-	c.Pin()
+	c.Release()
 
 	return true
 }
@@ -196,36 +308,120 @@ func (tr *Tracker) handleWorkspaceChange(c *store.Client) {
 	}
 	log.Debug("Client workspace handler fired [", c.Latest.Class, "]")
 
-	// Remove client from current workspace
-	ws := tr.ClientWorkspace(c)
-	ws.RemoveClient(c)
-
 	// Reset screen swapping event
 	tr.Handler.SwapScreen.Active = false
 
-	// Update client desktop and screen
+	// Untrack client that became untrackable (e.g. moved to an ignoring display)
 	if !tr.isTrackable(c.Win.Id) {
+		tr.untrackWindow(c.Win.Id)
 		return
 	}
+
+	// Remove client from current workspace
+	if ws := tr.ClientWorkspace(c); ws != nil {
+		ws.RemoveClient(c)
+	}
+
+	// Update client desktop and screen
 	c.Update()
-	if common.IsInIntList(int(c.Latest.ScreenNum), common.Config.StickyDisplays) {
+	tr.settleClient(c)
+
+	// Add client to new workspace
+	if ws := tr.ClientWorkspace(c); ws != nil {
+		ws.AddClient(c)
+	}
+	c.Restore(false)
+}
+
+func (tr *Tracker) settleClient(c *store.Client) {
+	dc := store.DisplayConfigGet(c.Latest.ScreenNum)
+	if dc == nil || dc.SettleDelay <= 0 {
+		tr.pinClient(c)
+		return
+	}
+
+	// Pin client after it settled on the new display
+	screenNum := c.Latest.ScreenNum
+	time.AfterFunc(time.Duration(dc.SettleDelay)*time.Millisecond, func() {
+		common.Dispatch(func() {
+			if tr.isTracked(c.Win.Id) && c.Latest.ScreenNum == screenNum {
+				tr.pinClient(c)
+			}
+		})
+	})
+}
+
+func (tr *Tracker) handleStateChange(c *store.Client) {
+	if !tr.isTracked(c.Win.Id) {
+		return
+	}
+
+	// Check sticky state change
+	sticky := c.IsSticky()
+	c.UpdateStates()
+	if sticky == c.IsSticky() {
+		return
+	}
+	log.Debug("Client state handler fired [", c.Latest.Class, "]")
+
+	// Window was stickied manually, keep explicit overrides
+	if c.IsSticky() {
+		if c.Override == "unsticky" && c.Respected {
+			c.Override = ""
+			c.Respected = false
+		}
+		return
+	}
+
+	// Window lost sticky state on a sticky display
+	c.Pinned = false
+	if c.Override != "" || !c.IsPinnable() {
+		return
+	}
+	switch common.Config.StickyPolicy {
+	case "enforce":
+		c.Enforce()
+	case "respect":
+		c.Respect()
+	}
+}
+
+func (tr *Tracker) handleScreenChange() {
+	log.Debug("Screen layout handler fired [", len(tr.Workspaces), "/", store.ScreenCount, "]")
+
+	// Rebuild workspaces for the new screen layout
+	tr.Workspaces = CreateWorkspaces()
+
+	// Re-evaluate screen and pin state of every client
+	for _, c := range tr.Clients {
+		c.Update()
+		if ws := tr.ClientWorkspace(c); ws != nil {
+			ws.AddClient(c)
+		}
+		tr.pinClient(c)
+	}
+}
+
+func (tr *Tracker) pinClient(c *store.Client) {
+	if c.IsPinnable() {
 		c.Pin()
 	} else {
 		c.UnPin()
 	}
-
-	// Add client to new workspace
-	ws = tr.ClientWorkspace(c)
-	ws.AddClient(c)
-	c.Restore(false)
 }
 
 func (tr *Tracker) onStateUpdate(aname string) {
+	screenChanged := common.IsInList(aname, []string{"RANDR_SCREEN_CHANGE"})
 	viewportChanged := common.IsInList(aname, []string{"_NET_NUMBER_OF_DESKTOPS", "_NET_DESKTOP_LAYOUT", "_NET_DESKTOP_GEOMETRY", "_NET_DESKTOP_VIEWPORT", "_NET_WORKAREA"})
 	clientsChanged := common.IsInList(aname, []string{"_NET_CLIENT_LIST_STACKING", "_NET_ACTIVE_WINDOW"})
 
+	// Screen layout changed
+	if screenChanged || (viewportChanged && uint(len(tr.Workspaces)) != store.ScreenCount) {
+		tr.handleScreenChange()
+	}
+
 	// Viewport changed or clients changed
-	if viewportChanged || clientsChanged {
+	if screenChanged || viewportChanged || clientsChanged {
 		tr.Update()
 
 		// Deactivate handlers
@@ -233,6 +429,17 @@ func (tr *Tracker) onStateUpdate(aname string) {
 	}
 }
 
+func (tr *Tracker) onConfigUpdate(event string) {
+	if event != "config-reloaded" || !common.ConfigChanged("sticky_displays", "window_ignore", "rules", "display") {
+		return
+	}
+	log.Debug("Config handler fired [", len(tr.Clients), "]")
+
+	// Re-evaluate tracked and pinned clients
+	tr.Update()
+	tr.Repin()
+}
+
 func (tr *Tracker) onPointerUpdate(button uint16) {
 	// Reset timer
 	if tr.Handler.Timer != nil {
@@ -247,11 +454,19 @@ func (tr *Tracker) onPointerUpdate(button uint16) {
 
 	// Wait for structure events
 	tr.Handler.Timer = time.AfterFunc(t*time.Millisecond, func() {
-
-		// Window moved to another screen
-		if tr.Handler.SwapScreen.Active {
-			tr.handleWorkspaceChange(tr.Handler.SwapScreen.Source)
-		}
+		common.Dispatch(func() {
+
+			// Window moved to another screen
+			if tr.Handler.SwapScreen.Active {
+				tr.handleWorkspaceChange(tr.Handler.SwapScreen.Source)
+			}
+
+			// Window moved by an action
+			if tr.Handler.MoveScreen.Active {
+				tr.Handler.MoveScreen.Active = false
+				tr.handleWorkspaceChange(tr.Handler.MoveScreen.Source)
+			}
+		})
 	})
 }
 
@@ -263,13 +478,18 @@ func (tr *Tracker) attachHandlers(c *store.Client) {
 		log.Trace("Client structure event [", c.Latest.Class, "]")
 
 		// Handle structure events
+		store.PointerUpdate(store.X)
 		tr.handleMoveClient(c)
 	}).Connect(store.X, c.Win.Id)
 
 	xevent.PropertyNotifyFun(func(x *xgbutil.XUtil, ev xevent.PropertyNotifyEvent) {
 		aname, _ := xprop.AtomName(store.X, ev.Atom)
 		log.Trace("Client property event ", aname, " [", c.Latest.Class, "]")
-		// TODO prevent unsetting sticky in selected display
+
+		// Handle state events
+		if aname == "_NET_WM_STATE" {
+			tr.handleStateChange(c)
+		}
 	}).Connect(store.X, c.Win.Id)
 }
 
@@ -279,6 +499,5 @@ func (tr *Tracker) isTracked(w xproto.Window) bool {
 }
 
 func (tr *Tracker) isTrackable(w xproto.Window) bool {
-	info := store.GetInfo(w)
-	return !store.IsSpecial(info) && !store.IsIgnored(info)
+	return store.IsTrackable(store.GetInfo(w))
 }
@@ -1,14 +1,20 @@
 package input
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
-	"golang.org/x/exp/maps"
+	"github.com/BurntSushi/xgb/xproto"
 
 	"github.com/seyys/sticky-display/common"
 	"github.com/seyys/sticky-display/desktop"
+	"github.com/seyys/sticky-display/ipc"
+	"github.com/seyys/sticky-display/store"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -25,20 +31,40 @@ func Execute(action string, mod string, tr *desktop.Tracker) bool {
 
 	log.Info("Execute action [", action, "-", mod, "]")
 
+	// Refresh current screen, plain pointer motion is not tracked
+	store.PointerUpdate(store.X)
+
+	// Split action arguments
+	fields := strings.Fields(action)
+	name, args := fields[0], fields[1:]
+
+	// Execute window actions on the active window
+	if isWindowAction(name) {
+		return ExecuteWindow(action, store.ActiveWindow, tr)
+	}
+
+	// Execute display actions once
+	if handled, success := executeDisplay(name, args, tr); handled {
+		return finishAction(action, success)
+	}
+
+	// Exit once, even without an active workspace
+	if name == "exit" {
+		return finishAction(action, Exit(tr))
+	}
+
 	for _, ws := range tr.Workspaces {
 		active := tr.ActiveWorkspace()
 
 		// Execute only on active screen
-		if mod == "current" && ws.Location != active.Location {
+		if mod == "current" && (active == nil || ws.Location != active.Location) {
 			continue
 		}
 
 		// Choose action command
-		switch action {
+		switch name {
 		case "enable":
 			success = Enable(tr, ws)
-		case "exit":
-			success = Exit(tr)
 		default:
 			success = External(action)
 		}
@@ -48,14 +74,10 @@ func Execute(action string, mod string, tr *desktop.Tracker) bool {
 		}
 
 		// Notify socket
-		type Action struct {
-			Desk   uint
-			Screen uint
-		}
-		NotifySocket(Message[Action]{
+		NotifySocket(ipc.Message[ipc.Action]{
 			Type: "Action",
 			Name: action,
-			Data: Action{Screen: ws.Location.ScreenNum},
+			Data: ipc.Action{Screen: ws.Location.ScreenNum},
 		})
 	}
 
@@ -65,47 +87,157 @@ func Execute(action string, mod string, tr *desktop.Tracker) bool {
 	return true
 }
 
-func Query(state string, tr *desktop.Tracker) bool {
-	success := false
-	if len(strings.TrimSpace(state)) == 0 {
+func ExecuteWindow(action string, w xproto.Window, tr *desktop.Tracker) bool {
+	if len(strings.TrimSpace(action)) == 0 {
 		return false
 	}
 
-	log.Info("Query state [", state, "]")
+	log.Info("Execute action [", action, "-", w, "]")
+
+	// Split action arguments
+	fields := strings.Fields(action)
+	name, args := fields[0], fields[1:]
+
+	// Apply to tracked or untracked windows
+	switch name {
+	case "pin":
+		tr.PinWindow(w, true)
+		return finishAction(action, true)
+	case "unpin":
+		tr.PinWindow(w, false)
+		return finishAction(action, true)
+	case "ignore":
+		return finishAction(action, IgnoreWindow(tr, w))
+	}
+
+	c, ok := tr.Clients[w]
+	if !ok {
+		log.Warn("No tracked window ", w, " for ", name)
+		return false
+	}
+
+	return finishAction(action, executeWindow(name, args, c, tr))
+}
 
-	ws := tr.ActiveWorkspace()
+func Query(state string, tr *desktop.Tracker, args ...string) (interface{}, error) {
+	if len(strings.TrimSpace(state)) == 0 {
+		return nil, fmt.Errorf("empty state")
+	}
+
+	log.Info("Query state [", state, "]")
 
 	// Choose state query
 	switch state {
 	case "workspaces":
-		type Workspaces struct {
-			Desk       uint
-			Screen     uint
-			Workspaces []*desktop.Workspace
-		}
-		NotifySocket(Message[Workspaces]{
-			Type: "State",
-			Name: state,
-			Data: Workspaces{Screen: ws.Location.ScreenNum, Workspaces: maps.Values(tr.Workspaces)},
+		store.PointerUpdate(store.X)
+		data := ipc.Workspaces{Workspaces: []ipc.Workspace{}}
+		for _, ws := range tr.Workspaces {
+			data.Workspaces = append(data.Workspaces, ipc.Workspace{Screen: ws.Location.ScreenNum})
+		}
+		sort.Slice(data.Workspaces, func(i, j int) bool {
+			return data.Workspaces[i].Screen < data.Workspaces[j].Screen
 		})
-		success = true
-	case "arguments":
-		NotifySocket(Message[common.Arguments]{
-			Type: "State",
-			Name: state,
-			Data: common.Args,
+		if ws := tr.ActiveWorkspace(); ws != nil {
+			data.Screen = ws.Location.ScreenNum
+		}
+		return data, nil
+	case "clients":
+		data := []ipc.Client{}
+		for _, c := range tr.Clients {
+			data = append(data, client(c))
+		}
+		sort.Slice(data, func(i, j int) bool {
+			return data[i].Id < data[j].Id
 		})
-		success = true
+		return data, nil
+	case "displays":
+		store.PointerUpdate(store.X)
+		data := []ipc.Display{}
+		screens := rects(store.ViewPorts.Screens)
+		desktops := rects(store.ViewPorts.Desktops)
+		outputs := outputs(store.ViewPorts.Outputs)
+		for i, screen := range screens {
+			display := ipc.Display{
+				Screen:   uint(i),
+				Geometry: screen,
+				Sticky:   store.IsStickyScreen(uint(i)),
+				Active:   uint(i) == store.CurrentScreen,
+			}
+			if i < len(desktops) {
+				display.Workarea = desktops[i]
+			}
+			if i < len(outputs) {
+				display.Output = outputs[i]
+			}
+			data = append(data, display)
+		}
+		return data, nil
+	case "mode":
+		return ActiveMode(), nil
+	case "info":
+		arg := ""
+		if len(args) > 0 {
+			arg = args[0]
+		}
+		w, err := store.WindowGet(arg)
+		if err != nil {
+			return nil, err
+		}
+		i := store.GetInfo(w)
+		x, y, width, height := i.Dimensions.Geometry.Pieces()
+		return ipc.Info{
+			Id:        uint32(w),
+			Class:     i.Class,
+			Instance:  i.Instance,
+			Name:      i.Name,
+			Role:      i.Role,
+			Transient: uint32(i.Transient),
+			Desk:      i.DeskNum,
+			Screen:    i.ScreenNum,
+			Types:     i.Types,
+			States:    i.States,
+			Geometry:  ipc.Rect{X: x, Y: y, Width: width, Height: height},
+		}, nil
+	case "arguments":
+		return common.Args, nil
 	case "configs":
-		NotifySocket(Message[common.Configuration]{
-			Type: "State",
-			Name: state,
-			Data: common.Config,
-		})
-		success = true
+		return common.Config, nil
+	case "config-errors":
+		return configErrors(), nil
+	case "explain":
+		arg := ""
+		if len(args) > 0 {
+			arg = args[0]
+		}
+		w, err := store.WindowGet(arg)
+		if err != nil {
+			return nil, err
+		}
+		d := tr.Explain(w)
+		return ipc.Decision{
+			Window:       uint32(d.Window),
+			Class:        d.Class,
+			Name:         d.Name,
+			ScreenNum:    d.ScreenNum,
+			Output:       ipc.Output(d.Output),
+			StickyScreen: d.StickyScreen,
+			Display:      d.Display,
+			SpecialTypes: d.SpecialTypes,
+			Special:      d.Special,
+			Ignored:      d.Ignored,
+			RuleNum:      d.RuleNum,
+			RuleOutcome:  d.RuleOutcome,
+			Maximized:    d.Maximized,
+			Tracked:      d.Tracked,
+			Override:     d.Override,
+			Pinned:       d.Pinned,
+			Sticky:       d.Sticky,
+			Action:       d.Action,
+			Trace:        d.Trace,
+		}, nil
 	}
 
-	return success
+	return nil, fmt.Errorf("unknown state %q", state)
 }
 
 func Enable(tr *desktop.Tracker, ws *desktop.Workspace) bool {
@@ -115,12 +247,148 @@ func Enable(tr *desktop.Tracker, ws *desktop.Workspace) bool {
 }
 
 func Exit(tr *desktop.Tracker) bool {
+	Shutdown(tr)
+
+	// Run exit handlers (flush requests, close log and lock files)
+	log.StandardLogger().Exit(0)
+
+	return true
+}
+
+func Shutdown(tr *desktop.Tracker) {
 	log.Info("Exit")
 
+	// Undo window states changed by the daemon
+	if !common.Args.KeepState {
+		tr.Reset()
+	}
+
 	os.Remove(common.Args.Sock + ".in")
-	os.Remove(common.Args.Sock + ".out")
+}
+
+func ToggleDisplay(tr *desktop.Tracker, args []string) bool {
+	if len(args) != 1 {
+		log.Warn("Missing display for toggle-display")
+		return false
+	}
 
-	os.Exit(1)
+	// Toggle sticky state of display
+	if isStickyDisplay(common.Display(args[0])) {
+		return RemoveDisplay(tr, args)
+	}
+
+	return AddDisplay(tr, args)
+}
+
+func AddDisplay(tr *desktop.Tracker, args []string) bool {
+	if len(args) != 1 {
+		log.Warn("Missing display for add-display")
+		return false
+	}
+	display := common.Display(args[0])
+	if displayPolicy(display) == "never" {
+		log.Warn("Display ", display, " is never sticky by its [display] policy")
+		return false
+	}
+	if isStickyDisplay(display) {
+		return true
+	}
+
+	log.Info("Add sticky display [", display, "]")
+
+	// Add display and re-pin clients
+	common.Config.StickyDisplays = append(common.Config.StickyDisplays, display)
+	updateDisplays(tr)
+
+	return true
+}
+
+func RemoveDisplay(tr *desktop.Tracker, args []string) bool {
+	if len(args) != 1 {
+		log.Warn("Missing display for remove-display")
+		return false
+	}
+	display := common.Display(args[0])
+	if displayPolicy(display) == "always" {
+		log.Warn("Display ", display, " is always sticky by its [display] policy")
+		return false
+	}
+
+	log.Info("Remove sticky display [", display, "]")
+
+	// Remove all entries that identify the same screens
+	displays := []common.Display{}
+	for _, d := range common.Config.StickyDisplays {
+		if d == display || sameScreens(d, display) {
+			continue
+		}
+		displays = append(displays, d)
+	}
+	common.Config.StickyDisplays = displays
+	updateDisplays(tr)
+
+	return true
+}
+
+func ToggleCurrentDisplay(tr *desktop.Tracker) bool {
+	screenNum := store.CurrentScreen
+
+	// Prefer stable output names over indices
+	id := strconv.Itoa(int(screenNum))
+	if int(screenNum) < len(store.ViewPorts.Outputs) && len(store.ViewPorts.Outputs[screenNum].Name) > 0 {
+		id = store.ViewPorts.Outputs[screenNum].Name
+	}
+
+	return ToggleDisplay(tr, []string{id})
+}
+
+func MoveNext(tr *desktop.Tracker, c *store.Client, offset int) bool {
+	if store.ScreenCount < 2 {
+		return false
+	}
+
+	// Cycle through screens
+	count := int(store.ScreenCount)
+	screenNum := (int(c.Latest.ScreenNum) + offset + count) % count
+
+	return tr.MoveClient(c, uint(screenNum))
+}
+
+func MoveTo(tr *desktop.Tracker, c *store.Client, args []string) bool {
+	if len(args) != 1 {
+		log.Warn("Missing display for move-to")
+		return false
+	}
+
+	// Move to first screen matching the display
+	for screenNum := uint(0); screenNum < store.ScreenCount; screenNum++ {
+		if store.ScreenMatches(screenNum, common.Display(args[0])) {
+			return tr.MoveClient(c, screenNum)
+		}
+	}
+
+	log.Warn("Unknown display ", args[0], " for move-to")
+	return false
+}
+
+func IgnoreWindow(tr *desktop.Tracker, w xproto.Window) bool {
+	info := store.GetInfo(w)
+	if len(info.Class) == 0 {
+		log.Warn("Missing window class for ignore [", w, "]")
+		return false
+	}
+
+	log.Info("Ignore window permanently [", info.Class, "]")
+
+	// Add ignore rule for window class before other rules, as merged from the written file
+	rule := common.Rule{Class: "^" + regexp.QuoteMeta(info.Class) + "$", Outcome: "ignore"}
+	common.Config.Rules = append([]common.Rule{rule}, common.Config.Rules...)
+	if err := common.WriteRule(common.Args.Config, rule); err != nil {
+		log.Warn("Error writing rule to config: ", err)
+	}
+
+	// Untrack ignored windows
+	tr.Update()
 
 	return true
 }
@@ -151,3 +419,114 @@ func executeCallbacks(arg string) {
 		fun(arg)
 	}
 }
+
+func executeDisplay(name string, args []string, tr *desktop.Tracker) (handled bool, success bool) {
+	switch name {
+	case "toggle-display":
+		return true, ToggleDisplay(tr, args)
+	case "add-display":
+		return true, AddDisplay(tr, args)
+	case "remove-display":
+		return true, RemoveDisplay(tr, args)
+	case "toggle-current-display":
+		return true, ToggleCurrentDisplay(tr)
+	}
+	return false, false
+}
+
+func executeWindow(name string, args []string, c *store.Client, tr *desktop.Tracker) bool {
+	switch name {
+	case "toggle-sticky":
+		tr.ToggleSticky(c)
+		return true
+	case "move-next":
+		return MoveNext(tr, c, 1)
+	case "move-prev":
+		return MoveNext(tr, c, -1)
+	case "move-to":
+		return MoveTo(tr, c, args)
+	case "send-to-sticky":
+		return tr.SendToSticky(c)
+	case "send-back":
+		return tr.SendBack(c)
+	case "choose-display":
+		return ChooseDisplay(c)
+	}
+
+	return false
+}
+
+func isWindowAction(name string) bool {
+	return common.IsInList(name, []string{"toggle-sticky", "move-next", "move-prev", "move-to", "send-to-sticky", "send-back", "choose-display", "pin", "unpin", "ignore"})
+}
+
+func finishAction(action string, success bool) bool {
+	if !success {
+		return false
+	}
+
+	// Notify socket
+	NotifySocket(ipc.Message[ipc.Action]{
+		Type: "Action",
+		Name: action,
+		Data: ipc.Action{Screen: store.CurrentScreen},
+	})
+
+	// Execute callbacks
+	executeCallbacks(action)
+
+	return true
+}
+
+func isStickyDisplay(display common.Display) bool {
+	for screenNum := uint(0); screenNum < store.ScreenCount; screenNum++ {
+		if store.ScreenMatches(screenNum, display) && store.IsStickyScreen(screenNum) {
+			return true
+		}
+	}
+	return common.IsInList(string(display), displayStrings(common.Config.StickyDisplays))
+}
+
+func displayPolicy(display common.Display) string {
+
+	// Policy of the display table matching the display
+	if dc, ok := common.Config.Displays[string(display)]; ok {
+		return dc.Policy
+	}
+	for screenNum := uint(0); screenNum < store.ScreenCount; screenNum++ {
+		if dc := store.DisplayConfigGet(screenNum); dc != nil && store.ScreenMatches(screenNum, display) {
+			return dc.Policy
+		}
+	}
+	return ""
+}
+
+func sameScreens(a common.Display, b common.Display) bool {
+	for screenNum := uint(0); screenNum < store.ScreenCount; screenNum++ {
+		if store.ScreenMatches(screenNum, a) && store.ScreenMatches(screenNum, b) {
+			return true
+		}
+	}
+	return false
+}
+
+func displayStrings(displays []common.Display) []string {
+	s := make([]string, len(displays))
+	for i, d := range displays {
+		s[i] = string(d)
+	}
+	return s
+}
+
+func updateDisplays(tr *desktop.Tracker) {
+
+	// Re-pin clients on changed displays
+	tr.Repin()
+
+	// Write displays back to config file
+	if common.Config.PersistDisplays {
+		if err := common.WriteStickyDisplays(common.Args.Config, common.Config.StickyDisplays); err != nil {
+			log.Warn("Error writing sticky displays to config: ", err)
+		}
+	}
+}
@@ -17,6 +17,32 @@ import (
 func BindKeys(tr *desktop.Tracker) {
 	keybind.Initialize(store.X)
 
+	// Bind keyboard shortcuts and modes
+	bindKeys(tr)
+	bindModes(tr)
+
+	// Rebind on config changes
+	common.OnConfigUpdate(func(event string) {
+		if event != "config-reloaded" || !common.ConfigChanged("keys", "modes") {
+			return
+		}
+		rebindKeys(tr)
+	})
+}
+
+func rebindKeys(tr *desktop.Tracker) {
+	log.Info("Rebind keyboard shortcuts")
+	leaveMode()
+
+	// Remove key bindings and the dispatcher keybind.Detach leaves behind
+	keybind.Detach(store.X, store.X.RootWin())
+	detachRoot(xevent.KeyPress)
+
+	bindKeys(tr)
+	bindModes(tr)
+}
+
+func bindKeys(tr *desktop.Tracker) {
 	actions := map[string]string{}
 	mods := map[string]string{"current": ""}
 
@@ -50,3 +76,11 @@ func bind(key string, action string, mod string, tr *desktop.Tracker) {
 		log.Warn("Error on action for ", action, ": ", err)
 	}
 }
+
+func detachRoot(evtype int) {
+	store.X.CallbacksLck.Lock()
+	defer store.X.CallbacksLck.Unlock()
+
+	// Remove root window callbacks of a single event type
+	delete(store.X.Callbacks[evtype], store.X.RootWin())
+}
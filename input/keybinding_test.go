@@ -0,0 +1,55 @@
+package input
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil/keybind"
+	"github.com/BurntSushi/xgbutil/xevent"
+
+	"github.com/seyys/sticky-display/common"
+	"github.com/seyys/sticky-display/desktop"
+	"github.com/seyys/sticky-display/internal/xtest"
+	"github.com/seyys/sticky-display/store"
+)
+
+func TestRebindKeys(t *testing.T) {
+	store.X, _ = xtest.Connect(t)
+	common.Config.Keys = map[string]string{"enable": "Mod4-a"}
+	common.Config.Modes = map[string]common.Mode{}
+
+	tr := &desktop.Tracker{Workspaces: make(map[desktop.Location]*desktop.Workspace)}
+	runs := countExecutes("enable")
+	BindKeys(tr)
+
+	// Each reload replaces the previous bindings
+	rebindKeys(tr)
+	rebindKeys(tr)
+
+	root := store.X.RootWin()
+	runCallbacks(xevent.KeyPress, xevent.KeyPressEvent{KeyPressEvent: &xproto.KeyPressEvent{
+		Root:   root,
+		Event:  root,
+		Detail: keybind.StrToKeycodes(store.X, "a")[0],
+		State:  xproto.ModMask4,
+	}})
+	if *runs != 1 {
+		t.Errorf("key press executed action %d times after two reloads, want 1", *runs)
+	}
+}
+
+func countExecutes(action string) *int {
+	runs := 0
+	OnExecute(func(executed string) {
+		if executed == action {
+			runs++
+		}
+	})
+	return &runs
+}
+
+func runCallbacks(evtype int, ev interface{}) {
+	for _, cb := range store.X.Callbacks[evtype][store.X.RootWin()] {
+		cb.Run(store.X, ev)
+	}
+}
@@ -0,0 +1,203 @@
+package input
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/keybind"
+	"github.com/BurntSushi/xgbutil/xevent"
+
+	"github.com/seyys/sticky-display/common"
+	"github.com/seyys/sticky-display/desktop"
+	"github.com/seyys/sticky-display/ipc"
+	"github.com/seyys/sticky-display/store"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	mode       string        // Name of the active binding mode
+	modeTarget xproto.Window // Window the active binding mode operates on
+	modeTimer  *time.Timer   // Timer to leave the active binding mode
+	chooser    common.Mode   // Display chooser binding mode
+)
+
+func ActiveMode() ipc.Mode {
+	if len(mode) == 0 {
+		return ipc.Mode{Name: "default", Keys: common.Config.Keys}
+	}
+	return ipc.Mode{Name: mode, Keys: modeGet(mode).Keys}
+}
+
+func ChooseDisplay(c *store.Client) bool {
+	if store.ScreenCount < 2 {
+		return false
+	}
+
+	// Map number keys to target displays
+	keys := map[string]string{}
+	for screenNum := uint(0); screenNum < store.ScreenCount && screenNum < 9; screenNum++ {
+		keys[fmt.Sprintf("move-to %d", screenNum)] = strconv.Itoa(int(screenNum) + 1)
+	}
+	chooser = common.Mode{Timeout: 5000, Keys: keys}
+
+	return enterMode("choose-display", c.Win.Id)
+}
+
+func bindModes(tr *desktop.Tracker) {
+	bindLeaders()
+
+	// Handle key presses while the keyboard is grabbed
+	xevent.KeyPressFun(func(X *xgbutil.XUtil, ev xevent.KeyPressEvent) {
+		if len(mode) > 0 {
+			handleMode(ev, tr)
+		}
+	}).Connect(store.X, store.X.RootWin())
+}
+
+func bindLeaders() {
+
+	// Bind leader keys
+	for name, m := range common.Config.Modes {
+		name := name
+		err := keybind.KeyPressFun(func(X *xgbutil.XUtil, ev xevent.KeyPressEvent) {
+			enterMode(name, 0)
+		}).Connect(store.X, store.X.RootWin(), m.Leader, true)
+
+		if err != nil {
+			log.Warn("Error on leader key for mode ", name, ": ", err)
+		}
+	}
+}
+
+func enterMode(name string, target xproto.Window) bool {
+	m := modeGet(name)
+
+	// Redirect all key presses to the root window
+	if len(mode) == 0 {
+		if err := keybind.GrabKeyboard(store.X, store.X.RootWin()); err != nil {
+			log.Warn("Error on entering mode ", name, ": ", err)
+			return false
+		}
+	}
+	mode = name
+	modeTarget = target
+
+	log.Info("Enter binding mode [", name, "]")
+
+	// Leave mode after timeout
+	resetModeTimer(m.Timeout)
+
+	// Notify socket
+	notifyMode()
+
+	return true
+}
+
+func leaveMode() {
+	if len(mode) == 0 {
+		return
+	}
+	keybind.UngrabKeyboard(store.X)
+
+	log.Info("Leave binding mode [", mode, "]")
+
+	// Stop timeout and reset mode
+	if modeTimer != nil {
+		modeTimer.Stop()
+	}
+	mode = ""
+	modeTarget = 0
+
+	// Notify socket
+	notifyMode()
+}
+
+func handleMode(ev xevent.KeyPressEvent, tr *desktop.Tracker) {
+	m := modeGet(mode)
+	target := modeTarget
+
+	// Escape always leaves the mode
+	if keyMatches("Escape", ev) {
+		leaveMode()
+		return
+	}
+
+	// Execute matching action
+	for action, key := range m.Keys {
+		if !keyMatches(key, ev) {
+			continue
+		}
+		if !m.Persistent {
+			leaveMode()
+		} else {
+			resetModeTimer(m.Timeout)
+		}
+		if target != 0 && isWindowAction(strings.Fields(action)[0]) {
+			ExecuteWindow(action, target, tr)
+		} else {
+			Execute(action, "current", tr)
+		}
+		return
+	}
+}
+
+func resetModeTimer(timeout int) {
+	if modeTimer != nil {
+		modeTimer.Stop()
+	}
+	if timeout <= 0 {
+		return
+	}
+
+	// Leave mode on the main loop
+	name := mode
+	modeTimer = time.AfterFunc(time.Duration(timeout)*time.Millisecond, func() {
+		common.Dispatch(func() {
+			if mode == name {
+				leaveMode()
+			}
+		})
+	})
+}
+
+func modeGet(name string) common.Mode {
+	if name == "choose-display" {
+		return chooser
+	}
+	return common.Config.Modes[name]
+}
+
+func notifyMode() {
+	active := ActiveMode()
+	NotifySocket(ipc.Message[ipc.Mode]{
+		Type: "Mode",
+		Name: active.Name,
+		Data: active,
+	})
+}
+
+func keyMatches(key string, ev xevent.KeyPressEvent) bool {
+	mods, codes, err := keybind.ParseString(store.X, key)
+	if err != nil {
+		return false
+	}
+
+	// Ignore lock modifiers
+	state := ev.State &^ (xproto.ModMaskLock | xproto.ModMask2)
+	if state != mods {
+		return false
+	}
+
+	for _, code := range codes {
+		if code == ev.Detail {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,10 +1,18 @@
 package input
 
 import (
-	"time"
+	"strings"
 
+	"github.com/BurntSushi/xgb/xfixes"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/mousebind"
+	"github.com/BurntSushi/xgbutil/xevent"
+
+	"github.com/seyys/sticky-display/common"
 	"github.com/seyys/sticky-display/desktop"
 	"github.com/seyys/sticky-display/store"
+
+	log "github.com/sirupsen/logrus"
 )
 
 var (
@@ -12,26 +20,80 @@ var (
 )
 
 func BindMouse(tr *desktop.Tracker) {
-	poll(100, func() {
-		store.PointerUpdate(store.X)
+	update(tr)
+
+	// Update pointer on cursor changes (e.g. window move start/end)
+	// The XInput2 raw events used for plain motion are generic events with extra data, which xgb cannot read,
+	// so actions and queries on the current screen refresh the pointer themselves
+	if store.X.ExtInitialized("XFIXES") {
+		xfixes.SelectCursorInput(store.X.Conn(), store.X.RootWin(), xfixes.CursorNotifyMaskDisplayCursor)
+	}
+	xevent.HookFun(func(X *xgbutil.XUtil, ev interface{}) bool {
+		if _, ok := ev.(xfixes.CursorNotifyEvent); !ok {
+			return true
+		}
+		update(tr)
+		return false
+	}).Connect(store.X)
+
+	// Bind mouse buttons
+	mousebind.Initialize(store.X)
+	bindButtons(tr)
 
-		// Update systray icon
-		ws := tr.ActiveWorkspace()
-		if ws != workspace {
-			workspace = ws
+	// Rebind on config changes
+	common.OnConfigUpdate(func(event string) {
+		if event != "config-reloaded" || !common.ConfigChanged("mouse") {
+			return
 		}
+		rebindButtons(tr)
 	})
 }
 
-func poll(t time.Duration, fun func()) {
-	fun()
-	go func() {
-		for range time.Tick(t * time.Millisecond) {
-			_, err := store.X.Conn().PollForEvent()
-			if err != nil {
-				continue
-			}
-			fun()
+func rebindButtons(tr *desktop.Tracker) {
+	log.Info("Rebind mouse buttons")
+
+	// Remove button bindings and the dispatcher mousebind.Detach leaves behind
+	mousebind.Detach(store.X, store.X.RootWin())
+	detachRoot(xevent.ButtonPress)
+
+	bindButtons(tr)
+}
+
+func bindButtons(tr *desktop.Tracker) {
+	for a, ab := range common.Config.Mouse {
+		bindButton(ab, a, tr)
+	}
+}
+
+func bindButton(button string, action string, tr *desktop.Tracker) {
+	err := mousebind.ButtonPressFun(func(X *xgbutil.XUtil, ev xevent.ButtonPressEvent) {
+		p := &common.Pointer{X: ev.RootX, Y: ev.RootY}
+
+		if !isWindowAction(strings.Fields(action)[0]) {
+			Execute(action, "current", tr)
+			return
+		}
+
+		// Execute on window under the pointer
+		c := tr.ClientAt(p)
+		if c == nil {
+			log.Warn("No window under the pointer for ", action)
+			return
 		}
-	}()
+		ExecuteWindow(action, c.Win.Id, tr)
+	}).Connect(store.X, store.X.RootWin(), button, false, true)
+
+	if err != nil {
+		log.Warn("Error on action for ", action, ": ", err)
+	}
+}
+
+func update(tr *desktop.Tracker) {
+	store.PointerUpdate(store.X)
+
+	// Update systray icon
+	ws := tr.ActiveWorkspace()
+	if ws != workspace {
+		workspace = ws
+	}
 }
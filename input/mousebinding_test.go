@@ -0,0 +1,37 @@
+package input
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil/xevent"
+
+	"github.com/seyys/sticky-display/common"
+	"github.com/seyys/sticky-display/desktop"
+	"github.com/seyys/sticky-display/internal/xtest"
+	"github.com/seyys/sticky-display/store"
+)
+
+func TestRebindButtons(t *testing.T) {
+	store.X, _ = xtest.Connect(t)
+	common.Config.Mouse = map[string]string{"enable": "Mod4-2"}
+
+	tr := &desktop.Tracker{Workspaces: make(map[desktop.Location]*desktop.Workspace)}
+	runs := countExecutes("enable")
+	BindMouse(tr)
+
+	// Each reload replaces the previous bindings
+	rebindButtons(tr)
+	rebindButtons(tr)
+
+	root := store.X.RootWin()
+	runCallbacks(xevent.ButtonPress, xevent.ButtonPressEvent{ButtonPressEvent: &xproto.ButtonPressEvent{
+		Root:   root,
+		Event:  root,
+		Detail: 2,
+		State:  xproto.ModMask4,
+	}})
+	if *runs != 1 {
+		t.Errorf("button press executed action %d times after two reloads, want 1", *runs)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/seyys/sticky-display/common"
 	"github.com/seyys/sticky-display/desktop"
 )
 
@@ -21,11 +22,16 @@ func BindSignal(tr *desktop.Tracker) {
 
 func exit(ch chan os.Signal, tr *desktop.Tracker) {
 	<-ch
-	Execute("exit", "current", tr)
+	common.Dispatch(func() {
+		Execute("exit", "current", tr)
+	})
 }
 
 func action(ch chan string, tr *desktop.Tracker) {
-	for {
-		Execute(<-ch, "current", tr)
+	for a := range ch {
+		a := a
+		common.Dispatch(func() {
+			Execute(a, "current", tr)
+		})
 	}
 }
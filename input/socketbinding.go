@@ -1,21 +1,35 @@
 package input
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
 	"os"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/xgbutil/xinerama"
 
 	"github.com/seyys/sticky-display/common"
 	"github.com/seyys/sticky-display/desktop"
+	"github.com/seyys/sticky-display/ipc"
+	"github.com/seyys/sticky-display/store"
 
 	log "github.com/sirupsen/logrus"
 )
 
-type Message[T any] struct {
-	Type string // Socket message type
-	Name string // Socket message name
-	Data T      // Socket message data
+var (
+	subscribers     = make(map[*Subscriber]bool) // Connected event subscribers
+	subscribersLock sync.Mutex                   // Guards subscribers map
+)
+
+type Subscriber struct {
+	Events  []string    // Subscribed event types or names
+	Queue   chan []byte // Queued outgoing messages
+	Dropped int         // Messages dropped since last delivery
 }
 
 func BindSocket(tr *desktop.Tracker) {
@@ -28,75 +42,324 @@ func BindSocket(tr *desktop.Tracker) {
 		return
 	}
 	go listen(listener, tr)
-}
 
-func NotifySocket[T any](m Message[T]) {
-	if _, err := os.Stat(common.Args.Sock + ".out"); os.IsNotExist(err) {
-		return
-	}
+	// Notify screen events
+	store.OnStateUpdate(func(aname string) {
+		if !common.IsInList(aname, []string{"RANDR_SCREEN_CHANGE", "_NET_DESKTOP_LAYOUT", "_NET_DESKTOP_GEOMETRY", "_NET_DESKTOP_VIEWPORT", "_NET_WORKAREA"}) {
+			return
+		}
+		NotifySocket(ipc.Message[ipc.Screen]{
+			Type: "Screen",
+			Name: "change",
+			Data: ipc.Screen{
+				Screens:  rects(store.ViewPorts.Screens),
+				Desktops: rects(store.ViewPorts.Desktops),
+				Outputs:  outputs(store.ViewPorts.Outputs),
+			},
+		})
+	})
 
-	// Create a unix domain socket dialer
-	dialer, err := net.Dial("unix", common.Args.Sock+".out")
-	if err != nil {
-		os.Remove(common.Args.Sock + ".out")
-		log.Warn("Dealer connection error: ", err)
-		return
-	}
+	// Notify config events
+	common.OnConfigUpdate(func(event string) {
+		if event == "config-error" {
+			NotifySocket(ipc.Message[[]string]{
+				Type: "Config",
+				Name: event,
+				Data: configErrors(),
+			})
+			return
+		}
+		NotifySocket(ipc.Message[common.Configuration]{
+			Type: "Config",
+			Name: event,
+			Data: common.Config,
+		})
+	})
+
+	// Notify client events
+	store.OnClientUpdate(func(event string, c *store.Client) {
+		NotifySocket(ipc.Message[ipc.Client]{
+			Type: "Client",
+			Name: event,
+			Data: client(c),
+		})
+	})
+}
+
+func NotifySocket[T any](m ipc.Message[T]) {
+	m.Version = ipc.Version
 
 	// Parse outgoing data
 	data, err := json.Marshal(m)
 	if err != nil {
-		log.Warn("Dealer parse error: ", err)
+		log.Warn("Notify parse error: ", err)
 		return
 	}
 
 	msg := string(data)
 	log.Info("Send socket message ", common.Truncate(msg, 100), "...")
 
-	// Write outgoing data
-	_, err = dialer.Write([]byte(msg))
-	if err != nil {
-		log.Warn("Dealer write error: ", err)
+	// Queue outgoing data for each subscriber
+	subscribersLock.Lock()
+	defer subscribersLock.Unlock()
+
+	for sub := range subscribers {
+		if sub.matches(m.Type, m.Name) {
+			sub.send(data)
+		}
 	}
 }
 
 func listen(listener net.Listener, tr *desktop.Tracker) {
 	for {
 
-		// Listen for incoming data
+		// Listen for incoming connections
 		connection, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			log.Warn("Listener closed: ", err)
+			return
+		}
 		if err != nil {
 			log.Warn("Listener accept error: ", err)
-			return
+			time.Sleep(100 * time.Millisecond)
+			continue
 		}
 
-		// Read incoming data
-		data := make([]byte, 4096)
-		n, err := connection.Read(data)
-		if err != nil {
-			log.Warn("Listener read error: ", err)
+		// Serve each connection on its own
+		go serve(connection, tr)
+	}
+}
+
+func serve(connection net.Conn, tr *desktop.Tracker) {
+	defer connection.Close()
+
+	scanner := bufio.NewScanner(connection)
+	scanner.Buffer(make([]byte, 4096), 1024*1024)
+	encoder := json.NewEncoder(connection)
+
+	for scanner.Scan() {
+		msg := strings.TrimSpace(scanner.Text())
+		if len(msg) == 0 {
+			continue
+		}
+		log.Info("Receive socket message ", common.Truncate(msg, 100), "...")
+
+		// Parse and handle incoming request
+		var request ipc.Request
+		exit := false
+		reply := ipc.Reply[interface{}]{Version: ipc.Version, Type: "Reply"}
+		if err := json.Unmarshal([]byte(msg), &request); err != nil {
+			reply.Code = ipc.CodeInvalid
+			reply.Error = fmt.Sprintf("invalid request: %s", err)
+		} else if request.Version > ipc.Version {
+			reply.Id = request.Id
+			reply.Code = ipc.CodeInvalid
+			reply.Error = fmt.Sprintf("unsupported protocol version %d", request.Version)
+		} else if request.Subscribe != nil {
+			reply.Id = request.Id
+			reply.Name = "subscribe"
+			reply.Data = request.Subscribe
+		} else {
+			reply, exit = handle(request, tr)
+		}
+
+		// Write reply to the same connection
+		if err := encoder.Encode(reply); err != nil {
+			log.Warn("Listener write error: ", err)
 			return
 		}
 
-		msg := strings.TrimSpace(string(data[:n]))
-		log.Info("Receive socket message ", common.Truncate(msg, 100), "...")
+		// Exit after the reply was written
+		if exit {
+			log.StandardLogger().Exit(0)
+		}
 
-		// Parse incoming data
-		var kv map[string]string
-		err = json.Unmarshal(data[:n], &kv)
-		if err != nil {
-			log.Warn("Listener parse error: ", err)
+		// Stream events until the connection is closed
+		if request.Subscribe != nil && reply.Code == ipc.CodeSuccess {
+			stream(connection, scanner, request.Subscribe)
 			return
 		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Warn("Listener read error: ", err)
+	}
+}
+
+func handle(request ipc.Request, tr *desktop.Tracker) (ipc.Reply[interface{}], bool) {
+	reply := ipc.Reply[interface{}]{Version: ipc.Version, Id: request.Id, Type: "Reply"}
+	exit := false
+
+	common.DispatchWait(func() {
+		switch {
 
 		// Execute action
-		if v, ok := kv["Action"]; ok {
-			Execute(v, "current", tr)
-		}
+		case len(request.Action) > 0:
+			reply.Name = request.Action
+			success := false
+			if success, exit = execute(request, tr); !success {
+				reply.Code = ipc.CodeFailed
+				reply.Error = fmt.Sprintf("action %q failed", request.Action)
+			}
 
 		// Query state
-		if v, ok := kv["State"]; ok {
-			Query(v, tr)
+		case len(request.State) > 0:
+			reply.Name = request.State
+			data, err := Query(request.State, tr, request.Window)
+			if err != nil {
+				reply.Code = ipc.CodeFailed
+				reply.Error = err.Error()
+			}
+			reply.Data = data
+
+		default:
+			reply.Code = ipc.CodeInvalid
+			reply.Error = "request without action or state"
 		}
+	})
+
+	return reply, exit
+}
+
+func execute(request ipc.Request, tr *desktop.Tracker) (bool, bool) {
+
+	// Shut down now and exit after the reply was written
+	if strings.TrimSpace(request.Action) == "exit" {
+		Shutdown(tr)
+		return finishAction(request.Action, true), true
+	}
+
+	if len(request.Window) == 0 {
+		return Execute(request.Action, "current", tr), false
+	}
+
+	// Execute on requested window
+	w, err := store.WindowGet(request.Window)
+	if err != nil {
+		log.Warn("Error on action window: ", err)
+		return false, false
+	}
+
+	return ExecuteWindow(request.Action, w, tr), false
+}
+
+func stream(connection net.Conn, scanner *bufio.Scanner, events []string) {
+	sub := &Subscriber{
+		Events: events,
+		Queue:  make(chan []byte, 256),
+	}
+
+	// Register subscriber
+	subscribersLock.Lock()
+	subscribers[sub] = true
+	subscribersLock.Unlock()
+
+	log.Info("Add socket subscriber ", events)
+
+	// Unregister subscriber on close
+	defer func() {
+		subscribersLock.Lock()
+		delete(subscribers, sub)
+		subscribersLock.Unlock()
+
+		log.Info("Remove socket subscriber ", events)
+	}()
+
+	// Detect closed connections
+	closed := make(chan struct{})
+	go func() {
+		for scanner.Scan() {
+		}
+		close(closed)
+	}()
+
+	// Write queued messages
+	for {
+		select {
+		case data := <-sub.Queue:
+			if _, err := connection.Write(append(data, '\n')); err != nil {
+				log.Warn("Subscriber write error: ", err)
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func (sub *Subscriber) matches(typ string, name string) bool {
+	if len(sub.Events) == 0 {
+		return true
+	}
+
+	// Match event type (e.g. client) or name (e.g. pin)
+	for _, event := range sub.Events {
+		if strings.EqualFold(event, typ) || strings.EqualFold(event, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (sub *Subscriber) send(data []byte) {
+
+	// Report messages dropped for slow readers
+	if sub.Dropped > 0 {
+		lost, _ := json.Marshal(ipc.Message[int]{Version: ipc.Version, Type: "Subscriber", Name: "dropped", Data: sub.Dropped})
+		select {
+		case sub.Queue <- lost:
+			sub.Dropped = 0
+		default:
+			sub.Dropped++
+			return
+		}
+	}
+
+	// Queue message without blocking the event loop
+	select {
+	case sub.Queue <- data:
+	default:
+		sub.Dropped++
+		log.Warn("Drop message for slow socket subscriber ", sub.Events)
+	}
+}
+
+func configErrors() []string {
+	errs := []string{}
+	for _, err := range common.ConfigErrors {
+		errs = append(errs, err.Error())
+	}
+	return errs
+}
+
+func rects(heads xinerama.Heads) []ipc.Rect {
+	r := make([]ipc.Rect, len(heads))
+	for i, head := range heads {
+		x, y, w, h := head.Pieces()
+		r[i] = ipc.Rect{X: x, Y: y, Width: w, Height: h}
+	}
+	return r
+}
+
+func outputs(outputs []store.Output) []ipc.Output {
+	o := make([]ipc.Output, len(outputs))
+	for i, output := range outputs {
+		o[i] = ipc.Output(output)
+	}
+	return o
+}
+
+func client(c *store.Client) ipc.Client {
+	return ipc.Client{
+		Id:       uint32(c.Win.Id),
+		Class:    c.Latest.Class,
+		Name:     c.Latest.Name,
+		Desk:     c.Latest.DeskNum,
+		Screen:   c.Latest.ScreenNum,
+		Pinned:   c.Pinned,
+		Sticky:   c.IsSticky(),
+		Override: c.Override,
+		Original: c.Original.States,
 	}
 }
@@ -0,0 +1,209 @@
+package input
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil/xwindow"
+
+	"github.com/seyys/sticky-display/common"
+	"github.com/seyys/sticky-display/desktop"
+	"github.com/seyys/sticky-display/ipc"
+	"github.com/seyys/sticky-display/store"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Run with 'go test -race' to detect tracker access outside the main event loop
+func TestSocketRace(t *testing.T) {
+	log.SetLevel(log.ErrorLevel)
+
+	tr := &desktop.Tracker{
+		Clients:    make(map[xproto.Window]*store.Client),
+		Workspaces: make(map[desktop.Location]*desktop.Workspace),
+		Handler: &desktop.Handler{
+			SwapScreen: &desktop.HandlerClient{},
+			MoveScreen: &desktop.HandlerClient{},
+		},
+	}
+
+	// Create and move windows on a fake main event loop
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for i := 0; ; i++ {
+			select {
+			case fun := <-common.Tasks():
+				fun()
+			case <-stop:
+				return
+			default:
+				mutateTracker(tr, i)
+			}
+		}
+	}()
+
+	// Hammer the socket from several connections
+	var wg sync.WaitGroup
+	for n := 0; n < 8; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			server, conn := net.Pipe()
+			defer conn.Close()
+			go serve(server, tr)
+
+			encoder, decoder := json.NewEncoder(conn), json.NewDecoder(conn)
+			for i := uint64(0); i < 200; i++ {
+				request := ipc.Request{Version: ipc.Version, Id: i, State: "clients"}
+				code := ipc.CodeSuccess
+				if i%2 == 1 {
+					request = ipc.Request{Version: ipc.Version, Id: i, Action: "toggle-sticky", Window: "0xffffff"}
+					code = ipc.CodeFailed
+				}
+				if err := encoder.Encode(request); err != nil {
+					t.Errorf("write request %d: %s", i, err)
+					return
+				}
+
+				var reply ipc.Reply[json.RawMessage]
+				if err := decoder.Decode(&reply); err != nil {
+					t.Errorf("read reply %d: %s", i, err)
+					return
+				}
+				if reply.Id != i || reply.Code != code {
+					t.Errorf("reply %d: got id %d with code %d, want code %d (%s)", i, reply.Id, reply.Code, code, reply.Error)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	close(stop)
+	<-stopped
+}
+
+func TestSocketReplies(t *testing.T) {
+	log.SetLevel(log.ErrorLevel)
+
+	tr := &desktop.Tracker{
+		Clients:    make(map[xproto.Window]*store.Client),
+		Workspaces: make(map[desktop.Location]*desktop.Workspace),
+	}
+
+	// Record exit and halt the exiting goroutine until the test ends
+	exits, halt := make(chan int, 1), make(chan struct{})
+	logger := log.StandardLogger()
+	exitFunc := logger.ExitFunc
+	logger.ExitFunc = func(code int) {
+		exits <- code
+		<-halt
+	}
+	t.Cleanup(func() {
+		close(halt)
+		logger.ExitFunc = exitFunc
+	})
+
+	// Serve a unix socket and run tasks on a fake main event loop
+	common.Args.Sock = filepath.Join(t.TempDir(), "sock")
+	listener, err := net.Listen("unix", common.Args.Sock+".in")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go listen(listener, tr)
+
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	go func() {
+		for {
+			select {
+			case fun := <-common.Tasks():
+				fun()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	conn, err := net.Dial("unix", common.Args.Sock+".in")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	scanner := bufio.NewScanner(conn)
+
+	// Each request gets exactly one reply
+	requests := []struct {
+		line string // Raw request line
+		id   uint64 // Expected reply id
+		code int    // Expected reply code
+	}{
+		{`{"version":1,"id":1,"state":"clients"}`, 1, ipc.CodeSuccess},
+		{`{"version":1,"id":2,"action":"toggle-sticky","window":"0xffffff"}`, 2, ipc.CodeFailed},
+		{`not json`, 0, ipc.CodeInvalid},
+		{`{"version":1,"id":4,"action":"exit"}`, 4, ipc.CodeSuccess},
+	}
+	for _, r := range requests {
+		if _, err := conn.Write([]byte(r.line + "\n")); err != nil {
+			t.Fatalf("write request %q: %s", r.line, err)
+		}
+		if !scanner.Scan() {
+			t.Fatalf("no reply to request %q: %v", r.line, scanner.Err())
+		}
+		var reply ipc.Reply[json.RawMessage]
+		if err := json.Unmarshal(scanner.Bytes(), &reply); err != nil {
+			t.Fatalf("read reply to request %q: %s", r.line, err)
+		}
+		if reply.Type != "Reply" || reply.Id != r.id || reply.Code != r.code {
+			t.Errorf("reply to request %q: got %s reply %d with code %d, want reply %d with code %d (%s)", r.line, reply.Type, reply.Id, reply.Code, r.id, r.code, reply.Error)
+		}
+	}
+
+	// Exit once after the exit reply was written
+	select {
+	case code := <-exits:
+		if code != 0 {
+			t.Errorf("exit with code %d, want 0", code)
+		}
+	case <-time.After(time.Second):
+		t.Error("exit action did not exit")
+	}
+
+	// No further replies
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if scanner.Scan() {
+		t.Errorf("unexpected extra reply %s", scanner.Text())
+	}
+}
+
+func mutateTracker(tr *desktop.Tracker, i int) {
+	w := xproto.Window(i%64 + 1)
+	location := desktop.Location{ScreenNum: uint(i % 3)}
+
+	// Create workspaces of changed screens
+	if _, ok := tr.Workspaces[location]; !ok {
+		tr.Workspaces[location] = &desktop.Workspace{Location: location}
+	}
+
+	// Create, move and destroy windows
+	c, ok := tr.Clients[w]
+	switch {
+	case !ok:
+		info := &store.Info{Class: "test", ScreenNum: location.ScreenNum}
+		tr.Clients[w] = &store.Client{Win: xwindow.New(nil, w), Original: info, Latest: info}
+	case i%5 == 0:
+		delete(tr.Clients, w)
+	default:
+		c.Latest = &store.Info{Class: "test", ScreenNum: location.ScreenNum, States: []string{"_NET_WM_STATE_STICKY"}}
+		c.Pinned = !c.Pinned
+	}
+}
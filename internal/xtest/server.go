@@ -0,0 +1,278 @@
+package xtest
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	opChangeWindowAttributes = 2 // Request opcodes answered by the fake server
+	opGetWindowAttributes    = 3
+	opGetGeometry            = 14
+	opQueryTree              = 15
+	opInternAtom             = 16
+	opGetAtomName            = 17
+	opGetProperty            = 20
+	opQueryPointer           = 38
+	opGetInputFocus          = 43
+	opQueryExtension         = 98
+	opGetKeyboardMapping     = 101
+	opGetModifierMapping     = 119
+)
+
+var keysyms = map[xproto.Keycode]xproto.Keysym{
+	38: 0x61, // Keyboard mapping of the fake server (a)
+}
+
+type Server struct {
+	atoms map[string]xproto.Atom   // Interned atoms by name
+	names map[xproto.Atom]string   // Interned atom names
+	masks map[xproto.Window]uint32 // Selected event masks
+	lock  sync.Mutex               // Guards selected event masks
+}
+
+type property struct {
+	Type   string // Property type atom name
+	Format byte   // Property format (8, 16 or 32)
+	Data   []byte // Property value
+}
+
+func Connect(tb testing.TB) (*xgbutil.XUtil, *Server) {
+	log.SetLevel(log.ErrorLevel)
+	xgb.Logger.SetOutput(io.Discard)
+	xgbutil.Logger.SetOutput(io.Discard)
+
+	listener, err := net.Listen("unix", filepath.Join(tb.TempDir(), "X0"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { listener.Close() })
+
+	// Serve a single client connection
+	s := &Server{
+		atoms: make(map[string]xproto.Atom),
+		names: make(map[xproto.Atom]string),
+		masks: make(map[xproto.Window]uint32),
+	}
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			s.serve(conn)
+		}
+	}()
+
+	conn, err := net.Dial("unix", listener.Addr().String())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	c, err := xgb.NewConnNet(conn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	X, err := xgbutil.NewConnXgb(c)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { X.Conn().Close() })
+
+	return X, s
+}
+
+func (s *Server) Mask(w xproto.Window) uint32 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.masks[w]
+}
+
+func (s *Server) SetMask(w xproto.Window, mask uint32) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.masks[w] = mask
+}
+
+func (s *Server) Changed(w xproto.Window) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, ok := s.masks[w]
+	return ok
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	// Accept connection setup
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return
+	}
+	auth := make([]byte, xgb.Pad(int(xgb.Get16(head[6:])))+xgb.Pad(int(xgb.Get16(head[8:]))))
+	if _, err := io.ReadFull(conn, auth); err != nil {
+		return
+	}
+	if _, err := conn.Write(s.setup()); err != nil {
+		return
+	}
+
+	// Reply to requests in order
+	for seq := uint16(1); ; seq++ {
+		req := make([]byte, 4)
+		if _, err := io.ReadFull(conn, req); err != nil {
+			return
+		}
+		req = append(req, make([]byte, int(xgb.Get16(req[2:]))*4-4)...)
+		if _, err := io.ReadFull(conn, req[4:]); err != nil {
+			return
+		}
+		if reply := s.reply(req, seq); reply != nil {
+			if _, err := conn.Write(reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *Server) setup() []byte {
+	vendor := "fake"
+	setup := xproto.SetupInfo{
+		Status:               1,
+		ProtocolMajorVersion: 11,
+		ResourceIdBase:       0x400000,
+		ResourceIdMask:       0x1fffff,
+		VendorLen:            uint16(len(vendor)),
+		MaximumRequestLength: 0xffff,
+		RootsLen:             1,
+		MinKeycode:           8,
+		MaxKeycode:           255,
+		Vendor:               vendor,
+		Roots: []xproto.ScreenInfo{{
+			Root:           1,
+			WidthInPixels:  1920,
+			HeightInPixels: 1080,
+			RootVisual:     1,
+			RootDepth:      24,
+		}},
+	}
+
+	buf := setup.Bytes()
+	xgb.Put16(buf[6:], uint16((len(buf)-8)/4))
+
+	return buf
+}
+
+func (s *Server) reply(req []byte, seq uint16) []byte {
+	buf := make([]byte, 32)
+	buf[0] = 1
+	xgb.Put16(buf[2:], seq)
+
+	switch req[0] {
+	case opInternAtom:
+		xgb.Put32(buf[8:], uint32(s.atom(string(req[8:8+xgb.Get16(req[4:])]))))
+	case opGetAtomName:
+		name := s.names[xproto.Atom(xgb.Get32(req[4:]))]
+		buf = append(buf, make([]byte, xgb.Pad(len(name)))...)
+		xgb.Put32(buf[4:], uint32(xgb.Pad(len(name))/4))
+		xgb.Put16(buf[8:], uint16(len(name)))
+		copy(buf[32:], name)
+	case opGetProperty:
+		p, ok := s.property(s.names[xproto.Atom(xgb.Get32(req[8:]))])
+		if !ok {
+			break
+		}
+		buf = append(buf, make([]byte, xgb.Pad(len(p.Data)))...)
+		buf[1] = p.Format
+		xgb.Put32(buf[4:], uint32(xgb.Pad(len(p.Data))/4))
+		xgb.Put32(buf[8:], uint32(s.atom(p.Type)))
+		xgb.Put32(buf[16:], uint32(len(p.Data)/int(p.Format/8)))
+		copy(buf[32:], p.Data)
+	case opQueryTree:
+		xgb.Put32(buf[8:], 1)
+		xgb.Put32(buf[12:], 1)
+	case opGetGeometry:
+		buf[1] = 24
+		xgb.Put32(buf[8:], 1)
+		xgb.Put16(buf[16:], 800)
+		xgb.Put16(buf[18:], 600)
+	case opGetWindowAttributes:
+		buf = append(buf, make([]byte, 12)...)
+		xgb.Put32(buf[4:], 3)
+		xgb.Put32(buf[36:], s.Mask(xproto.Window(xgb.Get32(req[4:]))))
+	case opChangeWindowAttributes:
+		if xgb.Get32(req[8:])&xproto.CwEventMask != 0 {
+			s.SetMask(xproto.Window(xgb.Get32(req[4:])), xgb.Get32(req[12:]))
+		}
+		return nil
+	case opQueryPointer:
+		buf[1] = 1
+		xgb.Put32(buf[8:], 1)
+	case opGetKeyboardMapping:
+		first, count := xproto.Keycode(req[4]), int(req[5])
+		buf = append(buf, make([]byte, 4*count)...)
+		buf[1] = 1
+		xgb.Put32(buf[4:], uint32(count))
+		for i := 0; i < count; i++ {
+			xgb.Put32(buf[32+4*i:], uint32(keysyms[first+xproto.Keycode(i)]))
+		}
+	case opGetModifierMapping:
+		buf = append(buf, make([]byte, 8)...)
+		buf[1] = 1
+		xgb.Put32(buf[4:], 2)
+	case opQueryExtension, opGetInputFocus:
+	default:
+		return nil
+	}
+
+	return buf
+}
+
+func (s *Server) property(name string) (property, bool) {
+	atoms := func(names ...string) []byte {
+		data := make([]byte, 4*len(names))
+		for i, name := range names {
+			xgb.Put32(data[4*i:], uint32(s.atom(name)))
+		}
+		return data
+	}
+
+	// Same properties for every window
+	switch name {
+	case "WM_CLASS":
+		return property{Type: "STRING", Format: 8, Data: []byte("xterm\x00XTerm\x00")}, true
+	case "WM_NAME":
+		return property{Type: "STRING", Format: 8, Data: []byte("Terminal")}, true
+	case "_NET_WM_WINDOW_TYPE":
+		return property{Type: "ATOM", Format: 32, Data: atoms("_NET_WM_WINDOW_TYPE_NORMAL")}, true
+	case "_NET_WM_STATE":
+		return property{Type: "ATOM", Format: 32, Data: atoms("_NET_WM_STATE_STICKY", "_NET_WM_STATE_ABOVE")}, true
+	case "_NET_WM_DESKTOP":
+		return property{Type: "CARDINAL", Format: 32, Data: make([]byte, 4)}, true
+	case "_NET_FRAME_EXTENTS":
+		return property{Type: "CARDINAL", Format: 32, Data: make([]byte, 16)}, true
+	}
+
+	return property{}, false
+}
+
+func (s *Server) atom(name string) xproto.Atom {
+	if atom, ok := s.atoms[name]; ok {
+		return atom
+	}
+
+	// Intern new atom
+	atom := xproto.Atom(len(s.atoms) + 100)
+	s.atoms[name] = atom
+	s.names[atom] = name
+
+	return atom
+}
@@ -0,0 +1,112 @@
+package ipc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+)
+
+type Conn struct {
+	Socket  net.Conn       // Socket connection
+	scanner *bufio.Scanner // Line reader for replies and events
+	encoder *json.Encoder  // Line writer for requests
+	lock    sync.Mutex     // Guards request/reply round trips
+	id      uint64         // Last request id
+}
+
+func Dial(path string) (*Conn, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), 1024*1024)
+
+	return &Conn{
+		Socket:  conn,
+		scanner: scanner,
+		encoder: json.NewEncoder(conn),
+	}, nil
+}
+
+func (c *Conn) Close() error {
+	return c.Socket.Close()
+}
+
+func (c *Conn) Execute(action string) error {
+	_, err := c.Send(Request{Action: action})
+	return err
+}
+
+func (c *Conn) Query(state string, window string, data interface{}) error {
+	reply, err := c.Send(Request{State: state, Window: window})
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return nil
+	}
+
+	// Decode reply data into the given value
+	return json.Unmarshal(reply.Data, data)
+}
+
+func (c *Conn) Subscribe(events ...string) (<-chan Message[json.RawMessage], error) {
+	if events == nil {
+		events = []string{}
+	}
+	if _, err := c.Send(Request{Subscribe: events}); err != nil {
+		return nil, err
+	}
+
+	// Stream events until the connection is closed
+	ch := make(chan Message[json.RawMessage])
+	go func() {
+		defer close(ch)
+		for c.scanner.Scan() {
+			var msg Message[json.RawMessage]
+			if err := json.Unmarshal(c.scanner.Bytes(), &msg); err != nil {
+				continue
+			}
+			ch <- msg
+		}
+	}()
+
+	return ch, nil
+}
+
+func (c *Conn) Send(request Request) (*Reply[json.RawMessage], error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// Write request
+	c.id++
+	request.Id = c.id
+	request.Version = Version
+	if err := c.encoder.Encode(request); err != nil {
+		return nil, err
+	}
+
+	// Read correlated reply
+	for c.scanner.Scan() {
+		var reply Reply[json.RawMessage]
+		if err := json.Unmarshal(c.scanner.Bytes(), &reply); err != nil {
+			return nil, err
+		}
+		if reply.Type != "Reply" || reply.Id != request.Id {
+			continue
+		}
+		if reply.Code != CodeSuccess {
+			return &reply, &Error{Code: reply.Code, Message: reply.Error}
+		}
+		return &reply, nil
+	}
+	if err := c.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, fmt.Errorf("connection closed")
+}
@@ -0,0 +1,147 @@
+package ipc
+
+import (
+	"fmt"
+)
+
+const (
+	Version = 1 // Version of the socket protocol
+)
+
+const (
+	CodeSuccess = 0 // Request succeeded
+	CodeInvalid = 1 // Request could not be parsed
+	CodeFailed  = 2 // Request failed to execute
+)
+
+type Message[T any] struct {
+	Version int    // Socket protocol version
+	Type    string // Socket message type
+	Name    string // Socket message name
+	Data    T      // Socket message data
+}
+
+type Request struct {
+	Version   int      // Socket protocol version
+	Id        uint64   // Request id echoed in the reply
+	Action    string   // Action to execute
+	State     string   // State to query
+	Window    string   // Window argument of the request
+	Subscribe []string // Event types to subscribe to (empty for all)
+}
+
+type Reply[T any] struct {
+	Version int    // Socket protocol version
+	Id      uint64 // Request id of the reply
+	Type    string // Socket message type
+	Name    string // Executed action or queried state
+	Code    int    // Result code
+	Error   string // Error message
+	Data    T      // Reply data
+}
+
+type Error struct {
+	Code    int    // Result code
+	Message string // Error message
+}
+
+type Action struct {
+	Desk   uint // Desktop the action was executed on
+	Screen uint // Screen the action was executed on
+}
+
+type Mode struct {
+	Name string            // Active binding mode (default if none)
+	Keys map[string]string // Key bindings of the active mode
+}
+
+type Workspaces struct {
+	Desk       uint        // Active desktop
+	Screen     uint        // Active screen
+	Workspaces []Workspace // List of workspaces
+}
+
+type Workspace struct {
+	Screen uint // Workspace screen number
+}
+
+type Client struct {
+	Id       uint32   // Window id
+	Class    string   // Window class name
+	Name     string   // Window title name
+	Desk     uint     // Window desktop
+	Screen   uint     // Window screen
+	Pinned   bool     // Sticky state was added by the daemon
+	Sticky   bool     // Window currently has sticky state
+	Override string   // Manual sticky override
+	Original []string // Window states before tracking started
+}
+
+type Info struct {
+	Id        uint32   // Window id
+	Class     string   // Window class name
+	Instance  string   // Window instance name
+	Name      string   // Window title name
+	Role      string   // Window role
+	Transient uint32   // Window transient for window
+	Desk      uint     // Window desktop
+	Screen    uint     // Window screen
+	Types     []string // Window types
+	States    []string // Window states
+	Geometry  Rect     // Window geometry including decorations
+}
+
+type Display struct {
+	Screen   uint   // Screen number
+	Output   Output // Screen identity
+	Geometry Rect   // Screen size (full monitor size)
+	Workarea Rect   // Desktop size (workarea without panels)
+	Sticky   bool   // Screen is configured as sticky display
+	Active   bool   // Pointer is on this screen
+}
+
+type Screen struct {
+	Screens  []Rect   // Screen size (full monitor size)
+	Desktops []Rect   // Desktop size (workarea without panels)
+	Outputs  []Output // Screen identities
+}
+
+type Rect struct {
+	X      int // Rectangle x position
+	Y      int // Rectangle y position
+	Width  int // Rectangle width
+	Height int // Rectangle height
+}
+
+type Output struct {
+	Name     string // RandR output name
+	Monitor  string // EDID monitor name
+	Serial   string // EDID monitor serial
+	Geometry string // Screen geometry
+}
+
+type Decision struct {
+	Window       uint32   // Window id
+	Class        string   // Window class name
+	Name         string   // Window title name
+	ScreenNum    uint     // Computed window screen
+	Output       Output   // Computed window screen identity
+	StickyScreen bool     // Screen is configured as sticky display
+	Display      string   // Matched display table identifier
+	SpecialTypes []string // Window types considered special
+	Special      string   // Matched special window type
+	Ignored      []string // Matched window ignore entry
+	RuleNum      int      // Matched rule index (-1 if none)
+	RuleOutcome  string   // Matched rule outcome
+	Maximized    bool     // Window is maximized
+	Tracked      bool     // Window is tracked by the daemon
+	Override     string   // Manual sticky override
+	Pinned       bool     // Sticky state was added by the daemon
+	Sticky       bool     // Window currently has sticky state
+	Action       string   // Resulting pin action (pin, unpin, ignore)
+	Trace        []string // Human readable decision steps
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
@@ -9,8 +9,7 @@ import (
 	"runtime/debug"
 	"syscall"
 
-	"github.com/BurntSushi/xgbutil/xevent"
-
+	"github.com/seyys/sticky-display/cli"
 	"github.com/seyys/sticky-display/common"
 	"github.com/seyys/sticky-display/desktop"
 	"github.com/seyys/sticky-display/input"
@@ -41,28 +40,61 @@ var (
 func main() {
 
 	// Init command line arguments
+	common.CommandUsage = cli.Usage()
 	common.InitArgs(name, version, commit, date)
 
+	// Run client command
+	if len(common.Args.Command) > 0 {
+		os.Exit(cli.Run(common.Args.Command))
+	}
+
 	// Init embedded files
 	common.InitFiles(toml)
 
+	// Check config file
+	if common.Args.CheckConfig {
+		os.Exit(checkConfig())
+	}
+
+	// Print merged config
+	if common.Args.PrintConfig {
+		config, err := common.AnnotatedConfig(common.Args.Config)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Print(config)
+		return
+	}
+
+	// Explain window decision
+	if len(common.Args.Explain) > 0 {
+		explain(common.Args.Explain)
+		return
+	}
+
 	// Init lock and log files
 	defer InitLock().Close()
 	InitLog()
 
-	// Init config and root
-	common.InitConfig()
+	// Init root and config
 	store.InitRoot()
+	common.InitConfig()
 
 	prepare()
 
 	if common.Args.PrintDisplay {
-		println("This is display", store.CurrentScreen)
+		output := store.Output{}
+		if int(store.CurrentScreen) < len(store.ViewPorts.Outputs) {
+			output = store.ViewPorts.Outputs[store.CurrentScreen]
+		}
+		fmt.Printf("This is display %d [output=%q, edid=%q, serial=%q, geometry=%q]\n",
+			store.CurrentScreen, output.Name, output.Monitor, output.Serial, output.Geometry)
 		return
 	}
 
 	// Run X event loop
-	xevent.Main(store.X)
+	store.Main(store.X)
 }
 
 func prepare() {
@@ -83,6 +115,48 @@ func prepare() {
 	input.BindKeys(tracker)
 }
 
+func explain(arg string) {
+	log.SetLevel(log.WarnLevel)
+
+	// Init root and config
+	store.InitRoot()
+	common.InitConfig()
+
+	// Compute decision trace
+	w, err := store.WindowGet(arg)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	d := store.Explain(w, nil)
+
+	for _, line := range d.Trace {
+		fmt.Println(line)
+	}
+	fmt.Println("(computed from config, use the socket query 'explain' for the client state of the running daemon)")
+}
+
+func checkConfig() int {
+	log.SetLevel(log.WarnLevel)
+
+	// Check display numbers if a display is available
+	if len(os.Getenv("DISPLAY")) > 0 {
+		store.InitRoot()
+	}
+
+	// Print validation errors
+	errs := common.CheckConfig(common.Args.Config)
+	for _, err := range errs {
+		fmt.Println(err)
+	}
+	if common.HasConfigErrors(errs) {
+		return 1
+	}
+	fmt.Printf("%s: ok\n", common.Args.Config)
+
+	return 0
+}
+
 func InitLock() *os.File {
 	file, err := createLockFile(common.Args.Lock)
 	if err != nil {
@@ -90,6 +164,13 @@ func InitLock() *os.File {
 		os.Exit(1)
 	}
 
+	// Release lock on exit
+	log.RegisterExitHandler(func() {
+		if file != nil {
+			file.Close()
+		}
+	})
+
 	return file
 }
 
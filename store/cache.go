@@ -0,0 +1,120 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/xevent"
+	"github.com/BurntSushi/xgbutil/xprop"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	infoCache   = make(map[xproto.Window]*Info) // Cached window information
+	infoWatched = make(map[xproto.Window]bool)  // Windows with selected invalidation events
+)
+
+type propertyRequest struct {
+	Name   string                    // Property atom name
+	Cookie *xproto.GetPropertyCookie // Pending property request
+}
+
+func InitCache() {
+
+	// Invalidate cached information on window changes
+	xevent.HookFun(func(X *xgbutil.XUtil, ev interface{}) bool {
+		switch e := ev.(type) {
+		case xproto.PropertyNotifyEvent:
+			InvalidateInfo(e.Window)
+		case xproto.ConfigureNotifyEvent:
+			InvalidateInfo(e.Window)
+		case xproto.DestroyNotifyEvent:
+			InvalidateInfo(e.Window)
+			delete(infoWatched, e.Window)
+		}
+		return true
+	}).Connect(X)
+}
+
+func InvalidateInfo(w xproto.Window) {
+	if _, ok := infoCache[w]; !ok {
+		return
+	}
+	log.Trace("Invalidate cached window info [", w, "]")
+
+	delete(infoCache, w)
+}
+
+func InvalidateInfos() {
+	log.Trace("Invalidate all cached window infos [", len(infoCache), "]")
+
+	infoCache = make(map[xproto.Window]*Info)
+}
+
+func PruneInfos(windows []xproto.Window) {
+	active := make(map[xproto.Window]bool)
+	for _, w := range windows {
+		active[w] = true
+	}
+
+	// Remove windows that are no longer managed
+	for w := range infoCache {
+		if !active[w] {
+			delete(infoCache, w)
+		}
+	}
+	for w := range infoWatched {
+		if !active[w] {
+			delete(infoWatched, w)
+		}
+	}
+}
+
+func watchInfo(w xproto.Window) {
+	if w == 0 || w == X.RootWin() || infoWatched[w] {
+		return
+	}
+
+	// Keep events already selected on the window
+	attributes, err := xproto.GetWindowAttributes(X.Conn(), w).Reply()
+	if err != nil {
+		log.Trace("Error on request ", err)
+		return
+	}
+	infoWatched[w] = true
+
+	// Select the same events tracked clients listen to
+	mask := attributes.YourEventMask | xproto.EventMaskStructureNotify | xproto.EventMaskPropertyChange | xproto.EventMaskFocusChange
+	xproto.ChangeWindowAttributes(X.Conn(), w, xproto.CwEventMask, []uint32{uint32(mask)})
+}
+
+func propertyCookie(w xproto.Window, name string) propertyRequest {
+	atom, err := xprop.Atm(X, name)
+	if err != nil {
+		return propertyRequest{Name: name}
+	}
+
+	// Send request without waiting for the reply
+	cookie := xproto.GetProperty(X.Conn(), false, w, atom, xproto.GetPropertyTypeAny, 0, (1<<32)-1)
+
+	return propertyRequest{Name: name, Cookie: &cookie}
+}
+
+func propertyReply(r propertyRequest) (*xproto.GetPropertyReply, error) {
+	if r.Cookie == nil {
+		return nil, fmt.Errorf("invalid property %s", r.Name)
+	}
+
+	// Wait for the reply
+	reply, err := r.Cookie.Reply()
+	if err != nil {
+		return nil, err
+	}
+	if reply.Format == 0 {
+		return nil, fmt.Errorf("no such property %s", r.Name)
+	}
+
+	return reply, nil
+}
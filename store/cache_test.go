@@ -0,0 +1,219 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil/ewmh"
+	"github.com/BurntSushi/xgbutil/icccm"
+	"github.com/BurntSushi/xgbutil/motif"
+	"github.com/BurntSushi/xgbutil/xprop"
+	"github.com/BurntSushi/xgbutil/xrect"
+	"github.com/BurntSushi/xgbutil/xwindow"
+
+	"github.com/seyys/sticky-display/internal/xtest"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestInvalidateInfo(t *testing.T) {
+	connectFake(t)
+	InitCache()
+
+	w, other := xproto.Window(0x200001), xproto.Window(0x200002)
+	events := []interface{}{
+		xproto.PropertyNotifyEvent{Window: w},
+		xproto.ConfigureNotifyEvent{Window: w},
+		xproto.DestroyNotifyEvent{Window: w},
+	}
+
+	// Each event drops only the entry of its window
+	for _, ev := range events {
+		GetInfo(w)
+		GetInfo(other)
+		for _, hook := range X.Hooks {
+			hook.Run(X, ev)
+		}
+		if _, ok := infoCache[w]; ok {
+			t.Errorf("%T kept cached info of window %#x", ev, w)
+		}
+		if _, ok := infoCache[other]; !ok {
+			t.Errorf("%T dropped cached info of window %#x", ev, other)
+		}
+	}
+	if infoWatched[w] {
+		t.Errorf("DestroyNotifyEvent kept window %#x watched", w)
+	}
+}
+
+func TestWatchInfo(t *testing.T) {
+	s := connectFake(t)
+
+	w := xproto.Window(0x200001)
+	s.SetMask(w, xproto.EventMaskButtonPress)
+
+	// Extend existing events and leave the root window alone
+	for _, w := range []xproto.Window{0, X.RootWin(), w} {
+		GetInfo(w)
+	}
+	X.Sync()
+
+	want := uint32(xproto.EventMaskButtonPress | xproto.EventMaskStructureNotify | xproto.EventMaskPropertyChange | xproto.EventMaskFocusChange)
+	if mask := s.Mask(w); mask != want {
+		t.Errorf("window %#x has event mask %#x, want %#x", w, mask, want)
+	}
+	for _, w := range []xproto.Window{0, X.RootWin()} {
+		if s.Changed(w) {
+			t.Errorf("window %#x had its event mask changed", w)
+		}
+	}
+}
+
+func BenchmarkGetInfo(b *testing.B) {
+	connectFake(b)
+
+	windows := make([]xproto.Window, 150)
+	for i := range windows {
+		windows[i] = xproto.Window(0x200000 + i)
+	}
+
+	// Read info of all windows from the cache
+	b.Run("cached", func(b *testing.B) {
+		for _, w := range windows {
+			GetInfo(w)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			for _, w := range windows {
+				GetInfo(w)
+			}
+		}
+	})
+
+	// Read info of all windows with batched property requests
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			InvalidateInfos()
+			for _, w := range windows {
+				GetInfo(w)
+			}
+		}
+	})
+
+	// Read info of all windows with the previous sequential requests
+	b.Run("unbatched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, w := range windows {
+				unbatchedInfo(w)
+			}
+		}
+	})
+}
+
+// Previous uncached implementation of GetInfo, waiting for each reply in turn
+func unbatchedInfo(w xproto.Window) *Info {
+	var err error
+
+	var class string
+	var name string
+	var deskNum uint
+	var screenNum uint
+	var types []string
+	var states []string
+	var dimensions Dimensions
+
+	// Window class (internal class name of the window)
+	cls, err := icccm.WmClassGet(X, w)
+	if err != nil {
+		log.Trace("Error on request ", err)
+	} else if cls != nil {
+		class = cls.Class
+	}
+
+	// Window name (title on top of the window)
+	name, err = icccm.WmNameGet(X, w)
+	if err != nil {
+		name = class
+	}
+
+	screenNum = GetScreenNum(w)
+
+	// Window types (types of the window)
+	types, err = ewmh.WmWindowTypeGet(X, w)
+	if err != nil {
+		types = []string{}
+	}
+
+	// Window states (states of the window)
+	states, err = ewmh.WmStateGet(X, w)
+	if err != nil {
+		states = []string{}
+	}
+
+	// Window geometry (dimensions of the window)
+	geometry, err := xwindow.New(X, w).DecorGeometry()
+	if err != nil {
+		geometry = &xrect.XRect{}
+	}
+
+	// Window normal hints (normal hints of the window)
+	nhints, err := icccm.WmNormalHintsGet(X, w)
+	if err != nil {
+		nhints = &icccm.NormalHints{}
+	}
+
+	// Window motif hints (hints of the window)
+	mhints, err := motif.WmHintsGet(X, w)
+	if err != nil {
+		mhints = &motif.Hints{}
+	}
+
+	// Window extents (server/client decorations of the window)
+	extNet, _ := xprop.PropValNums(xprop.GetProperty(X, w, "_NET_FRAME_EXTENTS"))
+	extGtk, _ := xprop.PropValNums(xprop.GetProperty(X, w, "_GTK_FRAME_EXTENTS"))
+
+	ext := make([]uint, 4)
+	for i, e := range extNet {
+		ext[i] += e
+	}
+	for i, e := range extGtk {
+		ext[i] -= e
+	}
+
+	// Window dimensions (geometry/extent information for move/resize)
+	dimensions = Dimensions{
+		Geometry: geometry,
+		Hints: Hints{
+			Normal: *nhints,
+			Motif:  *mhints,
+		},
+		Extents: ewmh.FrameExtents{
+			Left:   int(ext[0]),
+			Right:  int(ext[1]),
+			Top:    int(ext[2]),
+			Bottom: int(ext[3]),
+		},
+		AdjPos:  (extNet != nil && mhints.Flags&motif.HintDecorations > 0 && mhints.Decoration > 1) || (extGtk != nil),
+		AdjSize: (extNet != nil) || (extGtk != nil),
+	}
+
+	return &Info{
+		Class:      class,
+		Name:       name,
+		DeskNum:    deskNum,
+		ScreenNum:  screenNum,
+		Types:      types,
+		States:     states,
+		Dimensions: dimensions,
+	}
+}
+
+func connectFake(tb testing.TB) *xtest.Server {
+	var s *xtest.Server
+	X, s = xtest.Connect(tb)
+
+	infoCache = make(map[xproto.Window]*Info)
+	infoWatched = make(map[xproto.Window]bool)
+
+	return s
+}
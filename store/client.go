@@ -1,6 +1,7 @@
 package store
 
 import (
+	"fmt"
 	"strings"
 	"time"
 
@@ -11,28 +12,39 @@ import (
 	"github.com/BurntSushi/xgbutil/xprop"
 	"github.com/BurntSushi/xgbutil/xrect"
 	"github.com/BurntSushi/xgbutil/xwindow"
-	"github.com/dlclark/regexp2"
 
 	"github.com/seyys/sticky-display/common"
 
 	log "github.com/sirupsen/logrus"
 )
 
+var (
+	clientCallbacksFun []func(string, *Client) // Client events callback functions
+)
+
 type Client struct {
-	Win      *xwindow.Window `json:"-"` // X window object
-	Created  time.Time       // Internal client creation time
-	Original *Info           // Original client window information
-	Latest   *Info           // Latest client window information
+	Win       *xwindow.Window `json:"-"` // X window object
+	Created   time.Time       // Internal client creation time
+	Pinned    bool            // Sticky state was added by the daemon
+	States    []string        // Extra display states added by the daemon
+	Override  string          // Manual sticky override of the display rule
+	Respected bool            // Override was set by the respect sticky policy
+	Original  *Info           // Original client window information
+	Previous  *Info           // Client window information before it was sent to a sticky display
+	Latest    *Info           // Latest client window information
 }
 
 type Info struct {
-	Class      string     // Client window application name
-	Name       string     // Client window title name
-	DeskNum    uint       // Client window desktop
-	ScreenNum  uint       // Client window screen
-	Types      []string   // Client window types
-	States     []string   // Client window states
-	Dimensions Dimensions // Client window dimensions
+	Class      string        // Client window application name
+	Instance   string        // Client window instance name
+	Name       string        // Client window title name
+	Role       string        // Client window role
+	Transient  xproto.Window // Client window transient for window
+	DeskNum    uint          // Client window desktop
+	ScreenNum  uint          // Client window screen
+	Types      []string      // Client window types
+	States     []string      // Client window states
+	Dimensions Dimensions    // Client window dimensions
 }
 
 type Dimensions struct {
@@ -60,6 +72,9 @@ func CreateClient(w xproto.Window) *Client {
 	// Restore window decorations
 	c.Restore(false)
 
+	// Execute callbacks
+	clientCallbacks("track", c)
+
 	return c
 }
 
@@ -68,14 +83,111 @@ func (c *Client) Activate() {
 }
 
 func (c *Client) Pin() {
-	if common.IsInIntList(int(c.Latest.ScreenNum), common.Config.StickyDisplays) {
-		ewmh.WmStateReq(X, c.Win.Id, 1, "_NET_WM_STATE_STICKY")
+	if !c.IsPinnable() {
+		return
+	}
+
+	// Apply extra states of the current display
+	c.applyStates(displayStates(c.Latest.ScreenNum))
+	if c.Pinned {
+		return
+	}
+
+	// Keep sticky state the window already has
+	if c.IsSticky() {
+		return
 	}
+
+	// Add sticky state
+	ewmh.WmStateReq(X, c.Win.Id, 1, "_NET_WM_STATE_STICKY")
+	c.Pinned = true
+
+	// Execute callbacks
+	clientCallbacks("pin", c)
 }
 
 func (c *Client) UnPin() {
-	// TODO restore original sticky state
+
+	// Remove extra display states
+	c.applyStates(nil)
+	if !c.Pinned {
+		return
+	}
+
+	// Remove only the sticky state added by the daemon
 	ewmh.WmStateReq(X, c.Win.Id, 0, "_NET_WM_STATE_STICKY")
+	c.Pinned = false
+
+	// Execute callbacks
+	clientCallbacks("unpin", c)
+}
+
+func (c *Client) Release() {
+
+	// Remove sticky state added by the daemon
+	c.UnPin()
+
+	// Execute callbacks
+	clientCallbacks("untrack", c)
+}
+
+func (c *Client) Enforce() {
+	log.Info("Enforce sticky state [", c.Latest.Class, "]")
+
+	// Re-apply sticky state
+	c.Pin()
+
+	// Execute callbacks
+	clientCallbacks("enforce", c)
+}
+
+func (c *Client) Respect() {
+	log.Info("Respect manual sticky state [", c.Latest.Class, "]")
+
+	// Keep window unsticky until it is closed
+	c.Override = "unsticky"
+	c.Respected = true
+
+	// Execute callbacks
+	clientCallbacks("override", c)
+}
+
+func (c *Client) ToggleOverride() {
+
+	// Invert current sticky state
+	if c.IsSticky() {
+		c.SetOverride("unsticky")
+	} else {
+		c.SetOverride("sticky")
+	}
+}
+
+func (c *Client) SetOverride(override string) {
+	c.Override = override
+	c.Respected = false
+
+	// Apply manual sticky state
+	switch override {
+	case "sticky":
+		c.Pin()
+	case "unsticky":
+		c.Pinned = false
+		ewmh.WmStateReq(X, c.Win.Id, 0, "_NET_WM_STATE_STICKY")
+	}
+
+	log.Info("Override sticky state with ", c.Override, " [", c.Latest.Class, "]")
+
+	// Execute callbacks
+	clientCallbacks("override", c)
+}
+
+func (c *Client) IsPinnable() bool {
+	pinnable, _ := PinnableGet(c.Latest, c.Override)
+	return pinnable
+}
+
+func (c *Client) IsSticky() bool {
+	return common.IsInList("_NET_WM_STATE_STICKY", c.Latest.States)
 }
 
 func (c *Client) MoveResize(x, y, w, h int) {
@@ -98,9 +210,74 @@ func (c *Client) MoveResize(x, y, w, h int) {
 	}
 
 	// Update stored dimensions
+	InvalidateInfo(c.Win.Id)
 	c.Update()
 }
 
+func (c *Client) applyStates(states []string) {
+	added := []string{}
+
+	// Remove added states not wanted anymore
+	for _, state := range c.States {
+		if common.IsInList(state, states) {
+			added = append(added, state)
+			continue
+		}
+		ewmh.WmStateReq(X, c.Win.Id, 0, state)
+	}
+
+	// Add missing states, keep states the window already has
+	for _, state := range states {
+		if common.IsInList(state, added) || common.IsInList(state, c.Latest.States) {
+			continue
+		}
+		ewmh.WmStateReq(X, c.Win.Id, 1, state)
+		added = append(added, state)
+	}
+	c.States = added
+}
+
+func (c *Client) MoveToScreen(screenNum uint) bool {
+	if screenNum >= ScreenCount || screenNum == c.Latest.ScreenNum {
+		return false
+	}
+
+	// Source and target desktop dimensions
+	sx, sy, sw, sh := DesktopDimensions(c.Latest.ScreenNum)
+	tx, ty, tw, th := DesktopDimensions(screenNum)
+	if sw <= 0 || sh <= 0 {
+		return false
+	}
+
+	// Scale geometry relative to the desktop dimensions
+	x, y, w, h := c.Latest.Dimensions.Geometry.Pieces()
+	c.MoveResizeKeepState(tx+(x-sx)*tw/sw, ty+(y-sy)*th/sh, w*tw/sw, h*th/sh)
+
+	log.Info("Move window to screen ", screenNum, " [", c.Latest.Class, "]")
+
+	return true
+}
+
+func (c *Client) MoveResizeKeepState(x, y, w, h int) {
+
+	// Remove maximized states temporarily
+	states := []string{}
+	for _, state := range c.Latest.States {
+		if strings.HasPrefix(state, "_NET_WM_STATE_MAXIMIZED") {
+			states = append(states, state)
+			ewmh.WmStateReq(X, c.Win.Id, 0, state)
+		}
+	}
+
+	// Move and resize window
+	c.MoveResize(x, y, w, h)
+
+	// Restore maximized states
+	for _, state := range states {
+		ewmh.WmStateReq(X, c.Win.Id, 1, state)
+	}
+}
+
 func (c *Client) Update() {
 	info := GetInfo(c.Win.Id)
 	if len(info.Class) == 0 {
@@ -112,20 +289,36 @@ func (c *Client) Update() {
 	c.Latest = info
 }
 
+func (c *Client) UpdateStates() {
+	states, err := ewmh.WmStateGet(X, c.Win.Id)
+	if err != nil {
+		return
+	}
+
+	// Update client states
+	info := *c.Latest
+	info.States = states
+	c.Latest = &info
+}
+
 func (c *Client) Restore(original bool) {
 	c.Update()
 }
 
-func IsSpecial(info *Info) bool {
+func OnClientUpdate(fun func(string, *Client)) {
+	clientCallbacksFun = append(clientCallbacksFun, fun)
+}
 
-	// Check internal windows
-	if info.Class == common.Build.Name {
-		log.Info("Ignore internal window [", info.Class, "]")
-		return true
+func clientCallbacks(arg string, c *Client) {
+	log.Info("Client event ", arg, " [", c.Latest.Class, "]")
+
+	for _, fun := range clientCallbacksFun {
+		fun(arg, c)
 	}
+}
 
-	// Check window types
-	types := []string{
+var (
+	SpecialTypes = []string{
 		"_NET_WM_WINDOW_TYPE_DOCK",
 		"_NET_WM_WINDOW_TYPE_DESKTOP",
 		"_NET_WM_WINDOW_TYPE_TOOLBAR",
@@ -139,40 +332,128 @@ func IsSpecial(info *Info) bool {
 		"_NET_WM_WINDOW_TYPE_POPUP_MENU",
 		"_NET_WM_WINDOW_TYPE_MENU",
 		"_NET_WM_WINDOW_TYPE_DND",
+	} // Window types that are never tracked
+)
+
+func PinnableGet(info *Info, override string) (bool, string) {
+
+	// Check manual override
+	switch override {
+	case "sticky":
+		return true, "manual override"
+	case "unsticky":
+		return false, "manual override"
+	}
+
+	// Check display policy
+	if id := DisplayConfigId(info.ScreenNum); len(id) > 0 {
+		switch policy := common.Config.Displays[id].Policy; policy {
+		case "always", "never":
+			return policy == "always", fmt.Sprintf("policy %q of [display.%s]", policy, id)
+		}
+	}
+
+	// Check rule outcome
+	if num, rule := MatchRule(info); rule != nil {
+		return rule.Outcome == "sticky", fmt.Sprintf("outcome %q of rule %d", rule.Outcome, num)
+	}
+
+	return IsStickyScreen(info.ScreenNum), "sticky displays"
+}
+
+func IsTrackable(info *Info) bool {
+	special := SpecialGet(info)
+
+	// Never track internal windows
+	if special == "internal" {
+		return false
+	}
+
+	// Rules take precedence over builtin checks, special types need an explicit type match
+	if _, rule := MatchRule(info); rule != nil {
+		return rule.Outcome != "ignore" && (len(special) == 0 || len(rule.Type) > 0)
+	}
+
+	return len(special) == 0 && !IsIgnored(info)
+}
+
+func IsSpecial(info *Info) bool {
+	return len(SpecialGet(info)) > 0
+}
+
+func SpecialGet(info *Info) string {
+
+	// Check internal windows
+	if info.Class == common.Build.Name {
+		log.Info("Ignore internal window [", info.Class, "]")
+		return "internal"
 	}
+
+	// Check window types
 	for _, typ := range info.Types {
-		if common.IsInList(typ, types) {
+		if common.IsInList(typ, SpecialTypes) {
 			log.Info("Ignore window with type ", typ, " [", info.Class, "]")
-			return true
+			return typ
 		}
 	}
 
-	return false
+	return ""
 }
 
 func IsIgnored(info *Info) bool {
+	return IgnoredGet(info) != nil
+}
+
+func IgnoredGet(info *Info) []string {
 
-	// Check ignored windows
-	for _, s := range common.Config.WindowIgnore {
+	// Check ignored windows of config and display
+	ignore := common.Config.WindowIgnore
+	if dc := DisplayConfigGet(info.ScreenNum); dc != nil {
+		ignore = append(append([][]string{}, ignore...), dc.WindowIgnore...)
+	}
+	for _, s := range ignore {
+		if len(s) != 2 {
+			continue
+		}
 		conf_class := s[0]
 		conf_name := s[1]
 
-		reg_class := regexp2.MustCompile(strings.ToLower(conf_class), regexp2.None)
-		reg_name := regexp2.MustCompile(strings.ToLower(conf_name), regexp2.None)
-
 		// Ignore all windows with this class
-		class_match, _ := reg_class.MatchString(strings.ToLower(info.Class))
+		class_match := regexMatches(conf_class, info.Class)
 
 		// But allow the window with a special name
-		name_match, _ := reg_name.MatchString(strings.ToLower(info.Name))
+		name_match := regexMatches(conf_name, info.Name)
 
 		if class_match && conf_name != "" && !name_match {
 			log.Info("Ignore window with ", strings.TrimSpace(strings.Join(s, " ")), " from config [", info.Class, "]")
-			return true
+			return s
 		}
 	}
 
-	return false
+	return nil
+}
+
+func WindowState(state string) string {
+	state = strings.ToUpper(strings.TrimSpace(state))
+	if strings.HasPrefix(state, "_NET_WM_STATE_") {
+		return state
+	}
+	return "_NET_WM_STATE_" + strings.ReplaceAll(state, "-", "_")
+}
+
+func displayStates(screenNum uint) []string {
+	dc := DisplayConfigGet(screenNum)
+	if dc == nil {
+		return nil
+	}
+
+	// Normalize display state names
+	states := []string{}
+	for _, state := range dc.States {
+		states = append(states, WindowState(state))
+	}
+
+	return states
 }
 
 func IsMaximized(w xproto.Window) bool {
@@ -190,65 +471,122 @@ func IsMaximized(w xproto.Window) bool {
 }
 
 func GetInfo(w xproto.Window) *Info {
+
+	// Return cached window information
+	if info, ok := infoCache[w]; ok {
+		return info
+	}
+
+	// Read and cache window information
+	info := readInfo(w)
+	infoCache[w] = info
+	watchInfo(w)
+
+	return info
+}
+
+func readInfo(w xproto.Window) *Info {
 	var err error
 
 	var class string
+	var instance string
 	var name string
+	var role string
+	var transient xproto.Window
 	var deskNum uint
 	var screenNum uint
 	var types []string
 	var states []string
 	var dimensions Dimensions
 
+	// Send all property requests before waiting for replies
+	cls := propertyCookie(w, "WM_CLASS")
+	nam := propertyCookie(w, "WM_NAME")
+	rol := propertyCookie(w, "WM_WINDOW_ROLE")
+	tra := propertyCookie(w, "WM_TRANSIENT_FOR")
+	typ := propertyCookie(w, "_NET_WM_WINDOW_TYPE")
+	sta := propertyCookie(w, "_NET_WM_STATE")
+	des := propertyCookie(w, "_NET_WM_DESKTOP")
+	nhi := propertyCookie(w, "WM_NORMAL_HINTS")
+	mhi := propertyCookie(w, "_MOTIF_WM_HINTS")
+	eNet := propertyCookie(w, "_NET_FRAME_EXTENTS")
+	eGtk := propertyCookie(w, "_GTK_FRAME_EXTENTS")
+
 	// Window class (internal class name of the window)
-	cls, err := icccm.WmClassGet(X, w)
+	clsStrs, err := xprop.PropValStrs(propertyReply(cls))
 	if err != nil {
 		log.Trace("Error on request ", err)
-	} else if cls != nil {
-		class = cls.Class
+	} else if len(clsStrs) == 2 {
+		instance = clsStrs[0]
+		class = clsStrs[1]
 	}
 
 	// Window name (title on top of the window)
-	name, err = icccm.WmNameGet(X, w)
+	name, err = xprop.PropValStr(propertyReply(nam))
 	if err != nil {
 		name = class
 	}
 
-	screenNum = GetScreenNum(w)
+	// Window role (session role of the window)
+	role, err = xprop.PropValStr(propertyReply(rol))
+	if err != nil {
+		role = ""
+	}
+
+	// Window transient (parent window of dialogs)
+	transient, err = xprop.PropValWindow(propertyReply(tra))
+	if err != nil {
+		transient = 0
+	}
 
 	// Window types (types of the window)
-	types, err = ewmh.WmWindowTypeGet(X, w)
+	typReply, err := propertyReply(typ)
+	types, err = xprop.PropValAtoms(X, typReply, err)
 	if err != nil {
 		types = []string{}
 	}
 
 	// Window states (states of the window)
-	states, err = ewmh.WmStateGet(X, w)
+	staReply, err := propertyReply(sta)
+	states, err = xprop.PropValAtoms(X, staReply, err)
 	if err != nil {
 		states = []string{}
 	}
 
-	// Window geometry (dimensions of the window)
-	geometry, err := xwindow.New(X, w).DecorGeometry()
+	// Window desktop (desktop of the window)
+	deskNum, err = xprop.PropValNum(propertyReply(des))
 	if err != nil {
-		geometry = &xrect.XRect{}
+		deskNum = CurrentDesk
 	}
 
 	// Window normal hints (normal hints of the window)
-	nhints, err := icccm.WmNormalHintsGet(X, w)
-	if err != nil {
-		nhints = &icccm.NormalHints{}
+	nhints := &icccm.NormalHints{}
+	nhNums, err := xprop.PropValNums(propertyReply(nhi))
+	if err == nil && len(nhNums) == 18 {
+		nhints = &icccm.NormalHints{
+			Flags: nhNums[0], X: int(nhNums[1]), Y: int(nhNums[2]), Width: nhNums[3], Height: nhNums[4],
+			MinWidth: nhNums[5], MinHeight: nhNums[6], MaxWidth: nhNums[7], MaxHeight: nhNums[8],
+			WidthInc: nhNums[9], HeightInc: nhNums[10],
+			MinAspectNum: nhNums[11], MinAspectDen: nhNums[12], MaxAspectNum: nhNums[13], MaxAspectDen: nhNums[14],
+			BaseWidth: nhNums[15], BaseHeight: nhNums[16], WinGravity: nhNums[17],
+		}
+		if nhints.WinGravity <= 0 {
+			nhints.WinGravity = xproto.GravityNorthWest
+		}
 	}
 
 	// Window motif hints (hints of the window)
-	mhints, err := motif.WmHintsGet(X, w)
-	if err != nil {
-		mhints = &motif.Hints{}
+	mhints := &motif.Hints{}
+	mhNums, err := xprop.PropValNums(propertyReply(mhi))
+	if err == nil && len(mhNums) == 5 {
+		mhints = &motif.Hints{
+			Flags: mhNums[0], Function: mhNums[1], Decoration: mhNums[2], Input: mhNums[3], Status: mhNums[4],
+		}
 	}
 
 	// Window extents (server/client decorations of the window)
-	extNet, _ := xprop.PropValNums(xprop.GetProperty(X, w, "_NET_FRAME_EXTENTS"))
-	extGtk, _ := xprop.PropValNums(xprop.GetProperty(X, w, "_GTK_FRAME_EXTENTS"))
+	extNet, _ := xprop.PropValNums(propertyReply(eNet))
+	extGtk, _ := xprop.PropValNums(propertyReply(eGtk))
 
 	ext := make([]uint, 4)
 	for i, e := range extNet {
@@ -258,6 +596,14 @@ func GetInfo(w xproto.Window) *Info {
 		ext[i] -= e
 	}
 
+	// Window geometry (dimensions of the window)
+	geometry, err := xwindow.New(X, w).DecorGeometry()
+	if err != nil {
+		geometry = &xrect.XRect{}
+	} else {
+		screenNum = ScreenNumGet(geometryCenter(geometry))
+	}
+
 	// Window dimensions (geometry/extent information for move/resize)
 	dimensions = Dimensions{
 		Geometry: geometry,
@@ -277,7 +623,10 @@ func GetInfo(w xproto.Window) *Info {
 
 	return &Info{
 		Class:      class,
+		Instance:   instance,
 		Name:       name,
+		Role:       role,
+		Transient:  transient,
 		DeskNum:    deskNum,
 		ScreenNum:  screenNum,
 		Types:      types,
@@ -294,11 +643,14 @@ func GetScreenNum(w xproto.Window) uint {
 		return 0
 	}
 
+	return ScreenNumGet(geometryCenter(geom))
+}
+
+func geometryCenter(geom xrect.Rect) *common.Pointer {
+
 	// Window center position
-	center := &common.Pointer{
+	return &common.Pointer{
 		X: int16(geom.X() + (geom.Width() / 2)),
 		Y: int16(geom.Y() + (geom.Height() / 2)),
 	}
-
-	return ScreenNumGet(center)
 }
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/xgb/xproto"
+
+	"github.com/seyys/sticky-display/common"
+)
+
+type Decision struct {
+	Window       xproto.Window // Window id
+	Class        string        // Window class name
+	Name         string        // Window title name
+	ScreenNum    uint          // Computed window screen
+	Output       Output        // Computed window screen identity
+	StickyScreen bool          // Screen is configured as sticky display
+	Display      string        // Matched display table identifier
+	SpecialTypes []string      // Window types considered special
+	Special      string        // Matched special window type
+	Ignored      []string      // Matched window ignore entry
+	RuleNum      int           // Matched rule index (-1 if none)
+	RuleOutcome  string        // Matched rule outcome
+	Maximized    bool          // Window is maximized (moves are not handled)
+	Tracked      bool          // Window is tracked by the daemon
+	Override     string        // Manual sticky override
+	Pinned       bool          // Sticky state was added by the daemon
+	Sticky       bool          // Window currently has sticky state
+	Action       string        // Resulting pin action (pin, unpin, ignore)
+	Trace        []string      // Human readable decision steps
+}
+
+func Explain(w xproto.Window, c *Client) *Decision {
+	info := GetInfo(w)
+	if c != nil {
+		info = c.Latest
+	}
+
+	d := &Decision{
+		Window:       w,
+		Class:        info.Class,
+		Name:         info.Name,
+		ScreenNum:    info.ScreenNum,
+		StickyScreen: IsStickyScreen(info.ScreenNum),
+		SpecialTypes: SpecialTypes,
+		RuleNum:      -1,
+		Sticky:       common.IsInList("_NET_WM_STATE_STICKY", info.States),
+	}
+	if int(info.ScreenNum) < len(ViewPorts.Outputs) {
+		d.Output = ViewPorts.Outputs[info.ScreenNum]
+	}
+	d.trace("window %#x [class=%q, instance=%q, title=%q, role=%q]", w, info.Class, info.Instance, info.Name, info.Role)
+	d.trace("screen %d [output=%q, edid=%q, geometry=%q], sticky display: %t", d.ScreenNum, d.Output.Name, d.Output.Monitor, d.Output.Geometry, d.StickyScreen)
+
+	// Check display table
+	d.Display = DisplayConfigId(info.ScreenNum)
+	if len(d.Display) > 0 {
+		dc := common.Config.Displays[d.Display]
+		d.trace("matched [display.%s] [policy=%q, states=%q, window_ignore=%q, settle_delay=%d]", d.Display, dc.Policy, dc.States, dc.WindowIgnore, dc.SettleDelay)
+	}
+
+	// Check maximized state
+	for _, state := range info.States {
+		if strings.HasPrefix(state, "_NET_WM_STATE_MAXIMIZED") {
+			d.Maximized = true
+		}
+	}
+	if d.Maximized {
+		d.trace("window is maximized, moves between screens are not handled")
+	}
+
+	// Check special types
+	d.Special = SpecialGet(info)
+	if len(d.Special) > 0 {
+		d.trace("window is special (%s)", d.Special)
+	}
+
+	// Check rules
+	num, rule := MatchRule(info)
+	if rule != nil {
+		d.RuleNum = num
+		d.RuleOutcome = rule.Outcome
+		d.trace("matched rule %d with outcome %q", num, rule.Outcome)
+		if len(d.Special) > 0 && len(rule.Type) == 0 {
+			d.trace("rule does not match the window type, special window is not tracked")
+		}
+	} else {
+		d.trace("no rule matched")
+
+		// Check ignore list
+		d.Ignored = IgnoredGet(info)
+		if d.Ignored != nil {
+			d.trace("window is ignored by window_ignore entry %q", d.Ignored)
+		}
+	}
+
+	// Check client state
+	if c != nil {
+		d.Tracked = true
+		d.Override = c.Override
+		d.Pinned = c.Pinned
+		d.trace("window is tracked [override=%q, pinned=%t, sticky=%t]", d.Override, d.Pinned, d.Sticky)
+	} else {
+		d.trace("window is not tracked")
+	}
+
+	// Resulting action
+	pinnable, reason := PinnableGet(info, d.Override)
+	switch {
+	case !IsTrackable(info):
+		d.Action = "ignore"
+	case pinnable:
+		d.Action = "pin"
+	default:
+		d.Action = "unpin"
+	}
+	if d.Action != "ignore" {
+		d.trace("decided by %s", reason)
+	}
+	d.trace("resulting action: %s", d.Action)
+
+	return d
+}
+
+func WindowGet(s string) (xproto.Window, error) {
+	if len(s) == 0 || s == "active" {
+		return ActiveWindow, nil
+	}
+
+	// Parse decimal or hexadecimal window id
+	id, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid window id %q", s)
+	}
+
+	return xproto.Window(id), nil
+}
+
+func (d *Decision) trace(format string, a ...interface{}) {
+	d.Trace = append(d.Trace, fmt.Sprintf(format, a...))
+}
@@ -0,0 +1,247 @@
+package store
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/xgb/randr"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/xinerama"
+	"github.com/BurntSushi/xgbutil/xprop"
+	"github.com/BurntSushi/xgbutil/xrect"
+
+	"github.com/seyys/sticky-display/common"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	geometryPattern = regexp.MustCompile(`^\d+x\d+[+-]\d+[+-]\d+$`) // Geometry identifier pattern
+)
+
+type Output struct {
+	Name     string // RandR output name (e.g. DP-2)
+	Monitor  string // EDID monitor name
+	Serial   string // EDID monitor serial
+	Geometry string // Screen geometry (e.g. 1920x1080+0+0)
+}
+
+func OutputsGet(X *xgbutil.XUtil, screens xinerama.Heads) []Output {
+	outputs := make([]Output, len(screens))
+
+	// Geometry is always available
+	for i, rect := range screens {
+		outputs[i] = Output{Geometry: GeometryString(rect)}
+	}
+
+	// Output names and edid require randr
+	if !X.ExtInitialized("RANDR") {
+		return outputs
+	}
+
+	// Get the current screen resources
+	res, err := randr.GetScreenResourcesCurrent(X.Conn(), X.RootWin()).Reply()
+	if err != nil {
+		log.Warn("Error retrieving screen resources ", err)
+		return outputs
+	}
+
+	for _, o := range res.Outputs {
+		info, err := randr.GetOutputInfo(X.Conn(), o, res.ConfigTimestamp).Reply()
+		if err != nil || info.Connection != randr.ConnectionConnected || info.Crtc == 0 {
+			continue
+		}
+		crtc, err := randr.GetCrtcInfo(X.Conn(), info.Crtc, res.ConfigTimestamp).Reply()
+		if err != nil {
+			continue
+		}
+
+		// Assign output to the screen with the same geometry
+		rect := xrect.New(int(crtc.X), int(crtc.Y), int(crtc.Width), int(crtc.Height))
+		for i, screen := range screens {
+			if GeometryString(screen) != GeometryString(rect) || len(outputs[i].Name) > 0 {
+				continue
+			}
+			monitor, serial := edidGet(X, o)
+			outputs[i].Name = string(info.Name)
+			outputs[i].Monitor = monitor
+			outputs[i].Serial = serial
+			break
+		}
+	}
+
+	return outputs
+}
+
+func ScreenMatches(screenNum uint, display common.Display) bool {
+	id := strings.TrimSpace(string(display))
+	if len(id) == 0 {
+		return false
+	}
+
+	// Match legacy display index
+	if num, err := strconv.Atoi(id); err == nil {
+		return num >= 0 && uint(num) == screenNum
+	}
+
+	if int(screenNum) >= len(ViewPorts.Outputs) {
+		return false
+	}
+	output := ViewPorts.Outputs[screenNum]
+
+	// Match explicit identifier types
+	kind, value, found := strings.Cut(id, ":")
+	if found {
+		switch strings.ToLower(kind) {
+		case "output":
+			return strings.EqualFold(value, output.Name)
+		case "edid":
+			return equalFold(value, output.Monitor) || equalFold(value, output.Serial)
+		case "serial":
+			return equalFold(value, output.Serial)
+		case "geometry":
+			return value == output.Geometry
+		}
+	}
+
+	// Match implicit identifier types
+	if geometryPattern.MatchString(id) {
+		return id == output.Geometry
+	}
+
+	return equalFold(id, output.Name) || equalFold(id, output.Monitor) || equalFold(id, output.Serial)
+}
+
+func DisplayErrors(config common.Configuration) []common.ConfigError {
+	errs := []common.ConfigError{}
+	if ScreenCount == 0 {
+		return errs
+	}
+
+	// Check display numbers against connected screens
+	displays := append([]common.Display{}, config.StickyDisplays...)
+	for _, rule := range config.Rules {
+		displays = append(displays, rule.Display)
+	}
+	for id := range config.Displays {
+		displays = append(displays, common.Display(id))
+	}
+	for _, d := range displays {
+		num, err := strconv.Atoi(strings.TrimSpace(string(d)))
+		if err == nil && num >= int(ScreenCount) {
+			errs = append(errs, common.ConfigError{
+				Message: fmt.Sprintf("display number %d is out of range (%d screens connected)", num, ScreenCount),
+				Warning: true,
+			})
+		}
+	}
+
+	return errs
+}
+
+func DisplayConfigGet(screenNum uint) *common.DisplayConfig {
+	id := DisplayConfigId(screenNum)
+	if len(id) == 0 {
+		return nil
+	}
+
+	dc := common.Config.Displays[id]
+	return &dc
+}
+
+func DisplayConfigId(screenNum uint) string {
+
+	// Sort identifiers for a stable match order
+	ids := make([]string, 0, len(common.Config.Displays))
+	for id := range common.Config.Displays {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	// First table matching the screen wins
+	for _, id := range ids {
+		if ScreenMatches(screenNum, common.Display(id)) {
+			return id
+		}
+	}
+
+	return ""
+}
+
+func IsStickyScreen(screenNum uint) bool {
+
+	// Check display policy
+	if dc := DisplayConfigGet(screenNum); dc != nil {
+		switch dc.Policy {
+		case "always":
+			return true
+		case "never":
+			return false
+		}
+	}
+
+	for _, display := range common.Config.StickyDisplays {
+		if ScreenMatches(screenNum, display) {
+			return true
+		}
+	}
+	return false
+}
+
+func GeometryString(r xrect.Rect) string {
+	x, y, w, h := r.Pieces()
+	return fmt.Sprintf("%dx%d%+d%+d", w, h, x, y)
+}
+
+func edidGet(X *xgbutil.XUtil, o randr.Output) (monitor string, serial string) {
+
+	// Obtain edid atom
+	atom, err := xprop.Atm(X, "EDID")
+	if err != nil {
+		return
+	}
+
+	// Read raw edid block
+	prop, err := randr.GetOutputProperty(X.Conn(), o, atom, xproto.AtomAny, 0, 64, false, false).Reply()
+	if err != nil || len(prop.Data) < 128 {
+		return
+	}
+
+	return edidParse(prop.Data)
+}
+
+func edidParse(data []byte) (monitor string, serial string) {
+
+	// Parse display descriptor blocks
+	for offset := 54; offset+18 <= 126; offset += 18 {
+		block := data[offset : offset+18]
+		if block[0] != 0 || block[1] != 0 {
+			continue
+		}
+		text := strings.TrimSpace(strings.SplitN(string(block[5:]), "\n", 2)[0])
+		switch block[3] {
+		case 0xfc:
+			monitor = text
+		case 0xff:
+			serial = text
+		}
+	}
+
+	// Fallback to numeric serial number
+	if len(serial) == 0 {
+		num := uint32(data[12]) | uint32(data[13])<<8 | uint32(data[14])<<16 | uint32(data[15])<<24
+		if num != 0 {
+			serial = strconv.FormatUint(uint64(num), 10)
+		}
+	}
+
+	return
+}
+
+func equalFold(a string, b string) bool {
+	return len(b) > 0 && strings.EqualFold(a, b)
+}
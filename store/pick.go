@@ -0,0 +1,76 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgbutil"
+	"github.com/BurntSushi/xgbutil/xcursor"
+	"github.com/BurntSushi/xgbutil/xprop"
+)
+
+func PickWindow(X *xgbutil.XUtil) (xproto.Window, error) {
+	root := X.RootWin()
+
+	// Grab pointer with a crosshair cursor
+	cursor, err := xcursor.CreateCursor(X, xcursor.Crosshair)
+	if err != nil {
+		return 0, err
+	}
+	defer xproto.FreeCursor(X.Conn(), cursor)
+
+	mask := uint16(xproto.EventMaskButtonPress | xproto.EventMaskButtonRelease)
+	grab, err := xproto.GrabPointer(X.Conn(), false, root, mask, xproto.GrabModeSync, xproto.GrabModeAsync, root, cursor, xproto.TimeCurrentTime).Reply()
+	if err != nil {
+		return 0, err
+	}
+	if grab.Status != xproto.GrabStatusSuccess {
+		return 0, fmt.Errorf("pointer is already grabbed (status %d)", grab.Status)
+	}
+	defer xproto.UngrabPointer(X.Conn(), xproto.TimeCurrentTime)
+
+	// Wait for a button press and its release
+	picked := xproto.Window(0)
+	for pressed := false; ; {
+		xproto.AllowEvents(X.Conn(), xproto.AllowSyncPointer, xproto.TimeCurrentTime)
+		ev, err := X.Conn().WaitForEvent()
+		if ev == nil && err == nil {
+			return 0, fmt.Errorf("connection to X server closed")
+		}
+		switch e := ev.(type) {
+		case xproto.ButtonPressEvent:
+			if !pressed {
+				picked, pressed = e.Child, true
+			}
+		case xproto.ButtonReleaseEvent:
+			if pressed {
+				if picked == 0 || picked == root {
+					return 0, fmt.Errorf("no window picked")
+				}
+				return ClientWindowGet(X, picked), nil
+			}
+		}
+	}
+}
+
+func ClientWindowGet(X *xgbutil.XUtil, w xproto.Window) xproto.Window {
+
+	// Search the frame window tree for the client with WM_STATE
+	queue := []xproto.Window{w}
+	for len(queue) > 0 {
+		win := queue[0]
+		queue = queue[1:]
+
+		if _, err := xprop.GetProperty(X, win, "WM_STATE"); err == nil {
+			return win
+		}
+
+		tree, err := xproto.QueryTree(X.Conn(), win).Reply()
+		if err != nil {
+			continue
+		}
+		queue = append(queue, tree.Children...)
+	}
+
+	return w
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/seyys/sticky-display/common"
 
+	"github.com/BurntSushi/xgb/randr"
+	"github.com/BurntSushi/xgb/xfixes"
 	"github.com/BurntSushi/xgb/xproto"
 	"github.com/BurntSushi/xgbutil"
 	"github.com/BurntSushi/xgbutil/ewmh"
@@ -29,6 +31,7 @@ var (
 )
 
 var (
+	pointerPending      bool           // Pointer follow-up update is scheduled
 	pointerCallbacksFun []func(uint16) // Pointer events callback functions
 	stateCallbacksFun   []func(string) // State events callback functions
 )
@@ -36,6 +39,7 @@ var (
 type Head struct {
 	Screens  xinerama.Heads // Screen size (full monitor size)
 	Desktops xinerama.Heads // Desktop size (workarea without panels)
+	Outputs  []Output       // Screen identities (output name, edid, geometry)
 }
 
 func InitRoot() {
@@ -43,16 +47,49 @@ func InitRoot() {
 	// Connect to X server
 	X = Connect()
 
+	// Flush pending requests on exit
+	log.RegisterExitHandler(func() {
+		X.Sync()
+	})
+
 	// Init root properties
 	CurrentDesk = CurrentDesktopGet(X)
 	ActiveWindow = ActiveWindowGet(X)
 	Windows = ClientListStackingGet(X)
 	ViewPorts = ViewPortsGet(X)
 
+	// Init window info cache
+	InitCache()
+
+	// Validate display numbers
+	common.OnConfigValidate(DisplayErrors)
+
 	// Attach root events
 	root := xwindow.New(X, X.RootWin())
 	root.Listen(xproto.EventMaskPropertyChange)
 	xevent.PropertyNotifyFun(StateUpdate).Connect(X, root.Id)
+
+	// Attach screen events
+	if X.ExtInitialized("RANDR") {
+		randr.SelectInput(X.Conn(), root.Id, randr.NotifyMaskScreenChange|randr.NotifyMaskCrtcChange|randr.NotifyMaskOutputChange)
+		xevent.HookFun(ScreenUpdate).Connect(X)
+	}
+}
+
+func Main(X *xgbutil.XUtil) {
+
+	// Run X event callbacks and dispatched tasks one at a time
+	pingBefore, pingAfter, pingQuit := xevent.MainPing(X)
+	for {
+		select {
+		case <-pingBefore:
+			<-pingAfter
+		case fun := <-common.Tasks():
+			fun()
+		case <-pingQuit:
+			return
+		}
+	}
 }
 
 func Connect() *xgbutil.XUtil {
@@ -87,6 +124,21 @@ func Connect() *xgbutil.XUtil {
 	}
 	log.Info("Connected to X server [", wm, "]")
 
+	// Init randr extension
+	err = randr.Init(X.Conn())
+	if err != nil {
+		log.Warn("Error initializing randr extension ", err)
+	}
+
+	// Init xfixes extension
+	err = xfixes.Init(X.Conn())
+	if err == nil {
+		_, err = xfixes.QueryVersion(X.Conn(), 4, 0).Reply()
+	}
+	if err != nil {
+		log.Warn("Error initializing xfixes extension ", err)
+	}
+
 	return X
 }
 
@@ -154,13 +206,17 @@ func ViewPortsGet(X *xgbutil.XUtil) Head {
 			strut.BottomStartX, strut.BottomEndX)
 	}
 
+	// Get the screen identities
+	outputs := OutputsGet(X, screens)
+
 	// Update screen count
 	ScreenCount = uint(len(screens))
 
 	log.Info("Screens ", screens)
 	log.Info("Desktops ", desktops)
+	log.Info("Outputs ", outputs)
 
-	return Head{Screens: screens, Desktops: desktops}
+	return Head{Screens: screens, Desktops: desktops, Outputs: outputs}
 }
 
 func PhysicalHeadsGet(rGeom xrect.Rect) xinerama.Heads {
@@ -208,6 +264,24 @@ func ScreenNumGet(p *common.Pointer) uint {
 	return 0
 }
 
+func WindowAt(p *common.Pointer) xproto.Window {
+
+	// Check windows from top to bottom of the stack
+	for i := len(Windows) - 1; i >= 0; i-- {
+		info := GetInfo(Windows[i])
+		sticky := common.IsInList("_NET_WM_STATE_STICKY", info.States)
+		hidden := common.IsInList("_NET_WM_STATE_HIDDEN", info.States)
+		if hidden || (info.DeskNum != CurrentDesk && !sticky) {
+			continue
+		}
+		if common.IsInsideRect(p, info.Dimensions.Geometry) {
+			return Windows[i]
+		}
+	}
+
+	return 0
+}
+
 func DesktopDimensions(screenNum uint) (x, y, w, h int) {
 	if int(screenNum) >= len(ViewPorts.Desktops) {
 		return
@@ -233,6 +307,17 @@ func PointerUpdate(X *xgbutil.XUtil) {
 
 	// Update current screen
 	CurrentScreen = ScreenNumGet(CurrentPointer)
+
+	// Follow pointer until buttons are released (e.g. while dragging a window)
+	if CurrentPointer.Button != 0 && !pointerPending {
+		pointerPending = true
+		time.AfterFunc(100*time.Millisecond, func() {
+			common.Dispatch(func() {
+				pointerPending = false
+				PointerUpdate(X)
+			})
+		})
+	}
 }
 
 func StateUpdate(X *xgbutil.XUtil, e xevent.PropertyNotifyEvent) {
@@ -250,9 +335,11 @@ func StateUpdate(X *xgbutil.XUtil, e xevent.PropertyNotifyEvent) {
 		stateCallbacks(aname)
 	} else if common.IsInList(aname, []string{"_NET_DESKTOP_LAYOUT", "_NET_DESKTOP_GEOMETRY", "_NET_DESKTOP_VIEWPORT", "_NET_WORKAREA"}) {
 		ViewPorts = ViewPortsGet(X)
+		InvalidateInfos()
 		stateCallbacks(aname)
 	} else if common.IsInList(aname, []string{"_NET_CLIENT_LIST_STACKING"}) {
 		Windows = ClientListStackingGet(X)
+		PruneInfos(Windows)
 		stateCallbacks(aname)
 	} else if common.IsInList(aname, []string{"_NET_ACTIVE_WINDOW"}) {
 		ActiveWindow = ActiveWindowGet(X)
@@ -260,6 +347,29 @@ func StateUpdate(X *xgbutil.XUtil, e xevent.PropertyNotifyEvent) {
 	}
 }
 
+func ScreenUpdate(X *xgbutil.XUtil, ev interface{}) bool {
+
+	// Filter randr screen and crtc/output change events
+	switch e := ev.(type) {
+	case randr.ScreenChangeNotifyEvent:
+		log.Debug("Screen change event [", e.Width, "x", e.Height, "]")
+	case randr.NotifyEvent:
+		if e.SubCode != randr.NotifyCrtcChange && e.SubCode != randr.NotifyOutputChange {
+			return false
+		}
+		log.Debug("Screen notify event [", e.SubCode, "]")
+	default:
+		return true
+	}
+
+	// Update viewports and screen count
+	ViewPorts = ViewPortsGet(X)
+	InvalidateInfos()
+	stateCallbacks("RANDR_SCREEN_CHANGE")
+
+	return false
+}
+
 func OnPointerUpdate(fun func(uint16)) {
 	pointerCallbacksFun = append(pointerCallbacksFun, fun)
 }
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"strings"
+
+	"github.com/dlclark/regexp2"
+
+	"github.com/seyys/sticky-display/common"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	regexCache = make(map[string]*regexp2.Regexp) // Compiled rule expressions
+)
+
+func MatchRule(info *Info) (int, *common.Rule) {
+
+	// First matching rule wins
+	for i := range common.Config.Rules {
+		rule := &common.Config.Rules[i]
+		if RuleMatches(rule, info) {
+			log.Trace("Match rule ", i, " with outcome ", rule.Outcome, " [", info.Class, "]")
+			return i, rule
+		}
+	}
+
+	return -1, nil
+}
+
+func RuleMatches(rule *common.Rule, info *Info) bool {
+
+	// Match window properties
+	if !regexMatches(rule.Class, info.Class) ||
+		!regexMatches(rule.Instance, info.Instance) ||
+		!regexMatches(rule.Title, info.Name) ||
+		!regexMatches(rule.Role, info.Role) {
+		return false
+	}
+
+	// Match window type
+	if len(rule.Type) > 0 && !common.IsInList(WindowType(rule.Type), info.Types) {
+		return false
+	}
+
+	// Match transient window
+	if rule.Transient != nil && *rule.Transient != (info.Transient != 0) {
+		return false
+	}
+
+	// Match window display
+	if len(rule.Display) > 0 && !ScreenMatches(info.ScreenNum, rule.Display) {
+		return false
+	}
+
+	return true
+}
+
+func WindowType(typ string) string {
+	typ = strings.ToUpper(strings.TrimSpace(typ))
+	if strings.HasPrefix(typ, "_NET_WM_WINDOW_TYPE_") {
+		return typ
+	}
+	return "_NET_WM_WINDOW_TYPE_" + strings.ReplaceAll(typ, "-", "_")
+}
+
+func regexMatches(pattern string, value string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+
+	// Compile expression once
+	reg, ok := regexCache[pattern]
+	if !ok {
+		var err error
+		reg, err = regexp2.Compile(strings.ToLower(pattern), regexp2.None)
+		if err != nil {
+			log.Warn("Error compiling rule expression ", pattern, ": ", err)
+		}
+		regexCache[pattern] = reg
+	}
+	if reg == nil {
+		return false
+	}
+
+	match, _ := reg.MatchString(strings.ToLower(value))
+	return match
+}